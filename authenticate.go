@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// principal is the authenticated caller of a request.
+type principal struct {
+	UserID uuid.UUID
+	// APIKeyID is uuid.Nil when the caller logged in and sent a JWT.
+	APIKeyID uuid.UUID
+	// Scopes limits what an API key may do; JWT callers have every scope.
+	Scopes        []string
+	Role          database.Role
+	EmailVerified bool
+}
+
+func (p principal) hasScope(scope string) bool {
+	return p.APIKeyID == uuid.Nil || slices.Contains(p.Scopes, scope)
+}
+
+type principalContextKey struct{}
+
+// requestPrincipal returns the caller stored by requireAuth or requireLogin.
+// It must only be used by handlers behind one of them.
+func requestPrincipal(r *http.Request) principal {
+	p, ok := r.Context().Value(principalContextKey{}).(principal)
+	if !ok {
+		panic("requestPrincipal called on a route without auth middleware")
+	}
+	return p
+}
+
+// requireAuth authenticates the caller with either a JWT ("Authorization:
+// Bearer ...") or an API key ("Authorization: ApiKey ...") before calling
+// next. API keys must have been granted scope.
+func (cfg *apiConfig) requireAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := cfg.authenticateRequest(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		if !p.hasScope(scope) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", scope), nil)
+			return
+		}
+		ctx := withLogUser(r.Context(), p.UserID)
+		next(w, r.WithContext(context.WithValue(ctx, principalContextKey{}, p)))
+	}
+}
+
+// requireLogin is requireAuth for account management routes, which reject API
+// keys so a leaked key can't be used to mint new credentials.
+func (cfg *apiConfig) requireLogin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := cfg.authenticateRequest(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		if p.APIKeyID != uuid.Nil {
+			respondWithError(w, http.StatusForbidden, "This endpoint requires logging in; API keys aren't accepted", nil)
+			return
+		}
+		ctx := withLogUser(r.Context(), p.UserID)
+		next(w, r.WithContext(context.WithValue(ctx, principalContextKey{}, p)))
+	}
+}
+
+// requireRole is requireLogin for routes limited to users with at least role.
+func (cfg *apiConfig) requireRole(role database.Role, next http.HandlerFunc) http.HandlerFunc {
+	return cfg.requireLogin(func(w http.ResponseWriter, r *http.Request) {
+		if !requestPrincipal(r).Role.AtLeast(role) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("This endpoint requires the %s role", role), nil)
+			return
+		}
+		next(w, r)
+	})
+}
+
+var (
+	errInvalidJWT      = errors.New("invalid JWT")
+	errInvalidAPIKey   = errors.New("invalid API key")
+	errAPIKeyExpired   = errors.New("API key has expired")
+	errUnknownUser     = errors.New("user no longer exists")
+	errAccountDisabled = errors.New("account is disabled")
+)
+
+// authenticateRequest identifies the caller. The user is loaded on every
+// request so that disabling an account or changing its role takes effect
+// immediately rather than when its JWTs expire.
+func (cfg *apiConfig) authenticateRequest(r *http.Request) (principal, error) {
+	p, err := cfg.authenticateCredentials(r)
+	if err != nil {
+		return principal{}, err
+	}
+
+	user, err := cfg.db.GetUser(p.UserID)
+	if err != nil {
+		return principal{}, err
+	}
+	if user == nil {
+		return principal{}, errUnknownUser
+	}
+	if user.DisabledAt != nil {
+		return principal{}, errAccountDisabled
+	}
+	p.Role = user.Role
+	p.EmailVerified = user.EmailVerifiedAt != nil
+	return p, nil
+}
+
+func (cfg *apiConfig) authenticateCredentials(r *http.Request) (principal, error) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			return principal{}, err
+		}
+		userID, _, err := auth.ValidateJWT(token, cfg.jwtKeys)
+		if err != nil {
+			return principal{}, fmt.Errorf("%w: %v", errInvalidJWT, err)
+		}
+		return principal{UserID: userID}, nil
+	}
+
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+	key, err := cfg.db.GetAPIKeyByHash(auth.HashAPIKey(apiKey))
+	if err != nil {
+		return principal{}, err
+	}
+	if key.ID == uuid.Nil {
+		return principal{}, errInvalidAPIKey
+	}
+	if key.Expired(time.Now()) {
+		return principal{}, errAPIKeyExpired
+	}
+
+	err = cfg.db.TouchAPIKey(key.ID)
+	if err != nil {
+		// last-used tracking is informational; don't fail the request over it
+		logger(r.Context()).Warn("Couldn't record API key use", "error", err)
+	}
+	return principal{
+		UserID:   key.UserID,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
+// respondWithAuthError maps an authenticateRequest error to a response.
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrNoAuthHeaderIncluded):
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+	case errors.Is(err, errInvalidJWT):
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	case errors.Is(err, errInvalidAPIKey):
+		respondWithError(w, http.StatusUnauthorized, "Invalid API key", err)
+	case errors.Is(err, errAPIKeyExpired):
+		respondWithError(w, http.StatusUnauthorized, "API key has expired", err)
+	case errors.Is(err, errUnknownUser):
+		respondWithError(w, http.StatusUnauthorized, "User no longer exists", err)
+	case errors.Is(err, errAccountDisabled):
+		respondWithError(w, http.StatusForbidden, "Account is disabled", err)
+	case errors.Is(err, auth.ErrMalformedAuthHeader):
+		respondWithError(w, http.StatusUnauthorized, "Malformed Authorization header", err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't authenticate request", err)
+	}
+}
+
+// loadOwnedVideo loads the video named by the {videoID} path value and checks
+// the caller may modify it, responding with 400, 404 or 403 and returning
+// false otherwise.
+func (cfg *apiConfig) loadOwnedVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+	withLogVideo(r.Context(), videoID)
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if !authorizeVideo(w, r, video) {
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// authorizeVideo responds with 404 if video is the zero Video and with 403
+// unless the caller owns it or is a moderator, returning whether the handler
+// may proceed.
+func authorizeVideo(w http.ResponseWriter, r *http.Request, video database.Video) bool {
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return false
+	}
+	p := requestPrincipal(r)
+	if video.UserID != p.UserID && !p.Role.AtLeast(database.RoleModerator) {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this video", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerAdminUsersRetrieve(w http.ResponseWriter, r *http.Request) {
+	users, err := cfg.db.GetUsers()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve users", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+// handlerAdminUserVideosRetrieve lists another user's videos so moderators can
+// find ones to manage; it takes the same query parameters as GET /api/videos.
+func (cfg *apiConfig) handlerAdminUserVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	params, err := parseGetVideosParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.UserID = user.ID
+
+	page, err := cfg.db.GetVideos(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+func (cfg *apiConfig) handlerAdminUserRoleUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	user, ok := cfg.loadUser(w, r)
+	if !ok {
+		return
+	}
+	// keeps an admin from accidentally leaving the site without any admins
+	if user.ID == requestPrincipal(r).UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't change your own role", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	role, err := database.ParseRole(params.Role)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	err = cfg.db.SetUserRole(user.ID, role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update role", err)
+		return
+	}
+
+	cfg.respondWithUser(w, user.ID)
+}
+
+// handlerAdminUserDisable locks a user out: they can't log in, and their
+// sessions, JWTs and API keys stop working immediately.
+func (cfg *apiConfig) handlerAdminUserDisable(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.loadUser(w, r)
+	if !ok {
+		return
+	}
+	if user.ID == requestPrincipal(r).UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't disable your own account", nil)
+		return
+	}
+
+	err := cfg.db.DisableUser(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable user", err)
+		return
+	}
+	err = cfg.db.RevokeAllSessions(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	cfg.respondWithUser(w, user.ID)
+}
+
+func (cfg *apiConfig) handlerAdminUserEnable(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.EnableUser(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable user", err)
+		return
+	}
+
+	cfg.respondWithUser(w, user.ID)
+}
+
+// handlerAdminUserUnlock lifts a lockout from too many failed logins.
+func (cfg *apiConfig) handlerAdminUserUnlock(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.clearAccountThrottle(user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlock user", err)
+		return
+	}
+
+	cfg.respondWithUser(w, user.ID)
+}
+
+// loadUser loads the user named by the {userID} path value, responding with
+// 400 or 404 and returning false if there is none.
+func (cfg *apiConfig) loadUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return database.User{}, false
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return database.User{}, false
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return database.User{}, false
+	}
+	return *user, true
+}
+
+func (cfg *apiConfig) respondWithUser(w http.ResponseWriter, userID uuid.UUID) {
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+)
+
+const emailVerificationTokenLifetime = 48 * time.Hour
+
+// emailVerificationPolicy decides what users can do before verifying their email.
+type emailVerificationPolicy string
+
+const (
+	// emailVerificationOptional only sends the verification email.
+	emailVerificationOptional emailVerificationPolicy = "optional"
+	// emailVerificationUploads also blocks uploading videos and thumbnails.
+	emailVerificationUploads emailVerificationPolicy = "uploads"
+)
+
+func loadEmailVerificationPolicy() (emailVerificationPolicy, error) {
+	switch policy := emailVerificationPolicy(os.Getenv("EMAIL_VERIFICATION")); policy {
+	case "":
+		return emailVerificationOptional, nil
+	case emailVerificationOptional, emailVerificationUploads:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown EMAIL_VERIFICATION %q, expected optional or uploads", policy)
+	}
+}
+
+// normalizeEmail is applied to every email before it's stored or looked up,
+// so addresses match regardless of case or surrounding space.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateEmail accepts a bare address like "user@example.com", without a
+// display name or angle brackets.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("invalid email address %q", email)
+	}
+	return nil
+}
+
+// requireVerifiedEmail is used behind requireAuth on upload routes to enforce
+// the emailVerificationUploads policy.
+func (cfg *apiConfig) requireVerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.emailVerification == emailVerificationUploads && !requestPrincipal(r).EmailVerified {
+			respondWithError(w, http.StatusForbidden, "Verify your email address before uploading", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// sendVerificationEmail emails the user a new token for handlerVerifyEmail.
+func (cfg *apiConfig) sendVerificationEmail(user database.User) error {
+	token, err := auth.MakeEmailVerificationToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.db.CreateEmailVerificationToken(database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTokenLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	instructions := "Use this token to verify your email address:\n\n" + token
+	if cfg.emailVerificationURL != "" {
+		instructions = "Follow this link to verify your email address:\n\n" +
+			cfg.emailVerificationURL + "?token=" + url.QueryEscape(token)
+	}
+	cfg.sendMailInBackground(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Tubely email address",
+		Body: fmt.Sprintf(
+			"Welcome to Tubely!\n\n%s\n\nIt expires in %d hours. If you didn't sign up, you can ignore this email.\n",
+			instructions,
+			int(emailVerificationTokenLifetime.Hours()),
+		),
+	})
+	return nil
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Token is required", nil)
+		return
+	}
+
+	err = cfg.db.VerifyEmail(auth.HashToken(params.Token))
+	if errors.Is(err, database.ErrInvalidVerificationToken) {
+		respondWithError(w, http.StatusBadRequest, "Verification token is invalid or has expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerVerificationEmailResend sends another verification email, e.g. when
+// the first one expired.
+func (cfg *apiConfig) handlerVerificationEmailResend(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.db.GetUser(requestPrincipal(r).UserID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		respondWithError(w, http.StatusConflict, "Email address is already verified", nil)
+		return
+	}
+
+	err = cfg.sendVerificationEmail(*user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
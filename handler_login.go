@@ -14,11 +14,6 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 		Email    string `json:"email"`
 	}
-	type response struct {
-		database.User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
@@ -27,6 +22,17 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
+	params.Email = normalizeEmail(params.Email)
+
+	lockedFor, err := cfg.loginLockedFor(r, params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return
+	}
+	if lockedFor > 0 {
+		respondWithLoginLocked(w, lockedFor)
+		return
+	}
 
 	user, err := cfg.db.GetUserByEmail(params.Email)
 	if err != nil {
@@ -34,15 +40,53 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.Password)
-	if err != nil {
+	passwordHash := user.Password
+	if passwordHash == "" {
+		// unknown email, or a user who only logs in through OIDC
+		passwordHash = dummyPasswordHash()
+	}
+	err = auth.CheckPasswordHash(params.Password, passwordHash)
+	if err != nil || user.Password == "" {
+		recordErr := cfg.recordLoginFailure(r, params.Email)
+		if recordErr != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't record login attempt", recordErr)
+			return
+		}
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account is disabled", nil)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		// failures stay counted until the second factor is also right
+		cfg.respondWithTwoFactorChallenge(w, user)
+		return
+	}
+
+	err = cfg.clearAccountThrottle(user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record login attempt", err)
+		return
+	}
+
+	cfg.respondWithTokens(w, r, user)
+}
+
+// respondWithTokens starts a session for the user, responding with the user
+// and their new access and refresh tokens.
+func (cfg *apiConfig) respondWithTokens(w http.ResponseWriter, r *http.Request, user database.User) {
+	type response struct {
+		database.User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
-		cfg.jwtSecret,
+		string(user.Role),
+		cfg.jwtKeys,
 		time.Hour*24*30,
 	)
 	if err != nil {
@@ -60,12 +104,15 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		UserID:    user.ID,
 		Token:     refreshToken,
 		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+		UserAgent: clientUserAgent(r),
+		IPAddress: clientIP(r),
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
 		return
 	}
 
+	withLogUser(r.Context(), user.ID)
 	respondWithJSON(w, http.StatusOK, response{
 		User:         user,
 		Token:        accessToken,
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc"
+)
+
+const (
+	oidcStateCookie = "tubely_oidc_state"
+	// oidcLoginTimeout is how long a user has to log in at the provider.
+	oidcLoginTimeout = 10 * time.Minute
+)
+
+// loadOIDCProvider runs discovery against OIDC_ISSUER. It returns nil when
+// OIDC_ISSUER is unset, leaving single sign-on disabled.
+func loadOIDCProvider() (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		return nil, errors.New("OIDC_CLIENT_ID environment variable must be set with OIDC_ISSUER")
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		return nil, errors.New("OIDC_REDIRECT_URL environment variable must be set with OIDC_ISSUER")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return oidc.Discover(ctx, issuer, clientID, os.Getenv("OIDC_CLIENT_SECRET"), redirectURL)
+}
+
+// handlerOIDCLogin sends the browser to the identity provider. The state is
+// also set in a cookie so the callback only completes logins this browser started.
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var values [3]string
+	for i := range values {
+		value, err := oidc.NewCodeVerifier()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+			return
+		}
+		values[i] = value
+	}
+	state := database.OIDCState{
+		State:        values[0],
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginTimeout),
+	}
+
+	err := cfg.db.CreateOIDCState(state)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state.State,
+		Path:     "/api/oidc",
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, cfg.oidc.AuthCodeURL(state.State, state.Nonce, state.CodeVerifier), http.StatusFound)
+}
+
+// handlerOIDCCallback finishes a login started by handlerOIDCLogin and
+// responds like handlerLogin. Users are matched by their identity at the
+// provider, then by verified email; otherwise a new user is created.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		respondWithError(w, http.StatusUnauthorized, "Login failed: "+providerErr, nil)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		respondWithError(w, http.StatusBadRequest, "Invalid login state", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/api/oidc",
+		MaxAge: -1,
+	})
+
+	state, err := cfg.db.ConsumeOIDCState(cookie.Value)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get login state", err)
+		return
+	}
+	if state.State == "" {
+		respondWithError(w, http.StatusBadRequest, "Login expired, please try again", nil)
+		return
+	}
+
+	claims, err := cfg.oidc.Exchange(r.Context(), query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't verify login", err)
+		return
+	}
+
+	user, err := cfg.oidcUser(claims)
+	if errors.Is(err, errOIDCEmailTaken) {
+		respondWithError(w, http.StatusConflict, "An account with this email already exists; log in with your password", err)
+		return
+	}
+	if errors.Is(err, errOIDCNoEmail) {
+		respondWithError(w, http.StatusForbidden, "Your identity provider didn't share an email address", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find user", err)
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account is disabled", nil)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		// the identity provider only vouches for the first factor
+		cfg.respondWithTwoFactorChallenge(w, user)
+		return
+	}
+
+	cfg.respondWithTokens(w, r, user)
+}
+
+var (
+	errOIDCNoEmail    = errors.New("identity provider didn't share an email address")
+	errOIDCEmailTaken = errors.New("email belongs to an existing account but isn't verified by the identity provider")
+)
+
+// oidcUser finds or creates the user for the provider's claims, linking the
+// identity so later logins match it directly.
+func (cfg *apiConfig) oidcUser(claims oidc.Claims) (database.User, error) {
+	issuer := cfg.oidc.Issuer
+	user, err := cfg.db.GetUserByIdentity(issuer, claims.Subject)
+	if err != nil {
+		return database.User{}, err
+	}
+	if user != nil {
+		return *user, nil
+	}
+
+	claims.Email = normalizeEmail(claims.Email)
+	if claims.Email == "" {
+		return database.User{}, errOIDCNoEmail
+	}
+	existing, err := cfg.db.GetUserByEmail(claims.Email)
+	if err != nil {
+		return database.User{}, err
+	}
+	if existing.Email != "" {
+		// an unverified email could let anyone at the provider take the account over
+		if !claims.EmailVerified {
+			return database.User{}, errOIDCEmailTaken
+		}
+		user = &existing
+	} else {
+		// users created here have no password and can only log in through the provider
+		user, err = cfg.db.CreateUser(database.CreateUserParams{Email: claims.Email})
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+
+	err = cfg.db.LinkIdentity(user.ID, issuer, claims.Subject, claims.Email)
+	if err != nil {
+		return database.User{}, err
+	}
+	if claims.EmailVerified && user.EmailVerifiedAt == nil {
+		err = cfg.db.MarkEmailVerified(user.ID)
+		if err != nil {
+			return database.User{}, err
+		}
+		user, err = cfg.db.GetUser(user.ID)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	return *user, nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testOIDCClientID = "tubely"
+
+// mockIdP is an identity provider that logs in whichever user it was last
+// told to, checking PKCE like a real one.
+type mockIdP struct {
+	*httptest.Server
+	priv ed25519.PrivateKey
+	pub  ed25519.PublicKey
+
+	mu       sync.Mutex
+	pending  map[string]mockAuthorization
+	sub      string
+	email    string
+	verified bool
+	// tamper, when set, edits the ID token claims before they're signed.
+	tamper func(claims jwt.MapClaims)
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{priv: priv, pub: pub, pending: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(auth.JWKS{Keys: []auth.JWK{{
+			KeyType: "OKP",
+			KeyID:   "test",
+			Use:     "sig",
+			Alg:     "EdDSA",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(pub),
+		}}})
+	})
+	mux.HandleFunc("POST /token", idp.handleToken)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdP) setUser(sub, email string, verified bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.sub, idp.email, idp.verified = sub, email, verified
+}
+
+// authorize plays the user logging in at authURL, returning the code and
+// state the provider would redirect back with.
+func (idp *mockIdP) authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testOIDCClientID {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	code, err = oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	idp.pending[code] = mockAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	idp.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (idp *mockIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	code := r.Form.Get("code")
+	authorization, ok := idp.pending[code]
+	delete(idp.pending, code)
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            idp.URL,
+		"aud":            testOIDCClientID,
+		"sub":            idp.sub,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          authorization.nonce,
+		"email":          idp.email,
+		"email_verified": idp.verified,
+	}
+	if idp.tamper != nil {
+		idp.tamper(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(idp.priv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+func newOIDCTestConfig(t *testing.T) (*apiConfig, *mockIdP) {
+	t.Helper()
+	idp := newMockIdP(t)
+	cfg := newTestConfig(t)
+	provider, err := oidc.Discover(context.Background(), idp.URL, testOIDCClientID, "", "http://tubely.test/api/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.oidc = provider
+	return cfg, idp
+}
+
+// startOIDCLogin runs handlerOIDCLogin, returning the provider URL it
+// redirects to and the state cookie it sets.
+func startOIDCLogin(t *testing.T, cfg *apiConfig) (string, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.handlerOIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: got status %d, want %d", rec.Code, http.StatusFound)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return rec.Header().Get("Location"), cookie
+		}
+	}
+	t.Fatal("login didn't set the state cookie")
+	return "", nil
+}
+
+func oidcCallback(cfg *apiConfig, code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	query := url.Values{"code": {code}, "state": {state}}
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+query.Encode(), nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	cfg.handlerOIDCCallback(rec, req)
+	return rec
+}
+
+func TestOIDCLogin(t *testing.T) {
+	cfg, idp := newOIDCTestConfig(t)
+	idp.setUser("sub-1", "new@example.com", true)
+
+	var userIDs []string
+	for range 2 {
+		authURL, cookie := startOIDCLogin(t, cfg)
+		code, state := idp.authorize(t, authURL)
+		rec := oidcCallback(cfg, code, state, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("callback: got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+
+		var resp struct {
+			ID              string     `json:"id"`
+			Email           string     `json:"email"`
+			EmailVerifiedAt *time.Time `json:"email_verified_at"`
+			Token           string     `json:"token"`
+		}
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Email != "new@example.com" || resp.Token == "" || resp.EmailVerifiedAt == nil {
+			t.Fatalf("unexpected login response %+v", resp)
+		}
+		userIDs = append(userIDs, resp.ID)
+	}
+	if userIDs[0] != userIDs[1] {
+		t.Errorf("second login got user %s, want the linked user %s", userIDs[1], userIDs[0])
+	}
+}
+
+func TestOIDCCallbackStateMismatch(t *testing.T) {
+	cfg, idp := newOIDCTestConfig(t)
+	idp.setUser("sub-1", "new@example.com", true)
+
+	authURL, cookie := startOIDCLogin(t, cfg)
+	code, _ := idp.authorize(t, authURL)
+	// a state from a login this browser didn't start
+	otherURL, _ := startOIDCLogin(t, cfg)
+	_, otherState := idp.authorize(t, otherURL)
+
+	rec := oidcCallback(cfg, code, otherState, cookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+}
+
+func TestOIDCCallbackNonceMismatch(t *testing.T) {
+	cfg, idp := newOIDCTestConfig(t)
+	idp.setUser("sub-1", "new@example.com", true)
+	idp.tamper = func(claims jwt.MapClaims) {
+		claims["nonce"] = "replayed"
+	}
+
+	authURL, cookie := startOIDCLogin(t, cfg)
+	code, state := idp.authorize(t, authURL)
+	rec := oidcCallback(cfg, code, state, cookie)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+}
+
+func TestOIDCCallbackUnverifiedEmailNotLinked(t *testing.T) {
+	cfg, idp := newOIDCTestConfig(t)
+	hashedPassword, err := auth.HashPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.db.CreateUser(database.CreateUserParams{Email: "taken@example.com", Password: hashedPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.setUser("sub-2", "taken@example.com", false)
+
+	authURL, cookie := startOIDCLogin(t, cfg)
+	code, state := idp.authorize(t, authURL)
+	rec := oidcCallback(cfg, code, state, cookie)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+
+	linked, err := cfg.db.GetUserByIdentity(cfg.oidc.Issuer, "sub-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked != nil {
+		t.Errorf("identity was linked to %s", linked.Email)
+	}
+}
+
+func TestOIDCLoginRequiresTwoFactor(t *testing.T) {
+	cfg, idp := newOIDCTestConfig(t)
+	user, err := cfg.db.CreateUser(database.CreateUserParams{Email: "totp@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.db.SetTOTPSecret(user.ID, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.db.EnableTOTP(user.ID, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.setUser("sub-3", "totp@example.com", true)
+
+	authURL, cookie := startOIDCLogin(t, cfg)
+	code, state := idp.authorize(t, authURL)
+	rec := oidcCallback(cfg, code, state, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback: got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var resp struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+		Token             string `json:"token"`
+		RefreshToken      string `json:"refresh_token"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.TwoFactorRequired || resp.ChallengeToken == "" {
+		t.Errorf("got %+v, want a two-factor challenge", resp)
+	}
+	if resp.Token != "" || resp.RefreshToken != "" {
+		t.Error("callback issued tokens before the second factor")
+	}
+}
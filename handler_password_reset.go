@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+)
+
+const passwordResetTokenLifetime = time.Hour
+
+// handlerForgotPassword emails a password reset token. It responds the same
+// way whether or not the email belongs to a user, so it can't be used to find
+// out who has an account.
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Email = normalizeEmail(params.Email)
+	if params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email is required", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.Email == "" || user.DisabledAt != nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakePasswordResetToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create reset token", err)
+		return
+	}
+	err = cfg.db.CreatePasswordResetToken(database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTokenLifetime),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save reset token", err)
+		return
+	}
+
+	// sent in the background so response times don't reveal whether the user exists
+	cfg.sendMailInBackground(cfg.passwordResetMessage(user.Email, token))
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) passwordResetMessage(email, token string) mailer.Message {
+	instructions := "Use this token to choose a new password:\n\n" + token
+	if cfg.passwordResetURL != "" {
+		instructions = "Follow this link to choose a new password:\n\n" +
+			cfg.passwordResetURL + "?token=" + url.QueryEscape(token)
+	}
+	return mailer.Message{
+		To:      email,
+		Subject: "Reset your Tubely password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for your Tubely account.\n\n%s\n\n"+
+				"It expires in %d minutes and can only be used once. If you didn't ask for this, you can ignore this email.\n",
+			instructions,
+			int(passwordResetTokenLifetime.Minutes()),
+		),
+	}
+}
+
+// handlerResetPassword sets a new password with a token from
+// handlerForgotPassword and logs the user out of every session.
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Token == "" || params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Token and password are required", nil)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	err = cfg.db.ResetPassword(auth.HashToken(params.Token), hashedPassword)
+	if errors.Is(err, database.ErrInvalidResetToken) {
+		respondWithError(w, http.StatusBadRequest, "Reset token is invalid or has expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
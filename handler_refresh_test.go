@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func refresh(t *testing.T, cfg *apiConfig, refreshToken string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshToken)
+	rec := httptest.NewRecorder()
+	cfg.handlerRefresh(rec, req)
+
+	var resp struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if rec.Code == http.StatusOK {
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, resp.RefreshToken
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	cfg := newTestConfig(t)
+	hashedPassword, err := auth.HashPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.db.CreateUser(database.CreateUserParams{Email: "user@example.com", Password: hashedPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := login(cfg, "user@example.com", "pw")
+	var session struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an unrelated session of the same user, which must survive
+	rec = login(cfg, "user@example.com", "pw")
+	var other struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, rotated := refresh(t, cfg, session.RefreshToken)
+	if code != http.StatusOK || rotated == "" || rotated == session.RefreshToken {
+		t.Fatalf("first refresh: got status %d and token %q", code, rotated)
+	}
+
+	steps := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "replayed rotated token", token: session.RefreshToken, want: http.StatusUnauthorized},
+		{name: "token rotated from the replayed one", token: rotated, want: http.StatusUnauthorized},
+		{name: "other session", token: other.RefreshToken, want: http.StatusOK},
+		{name: "unknown token", token: "not-a-token", want: http.StatusUnauthorized},
+	}
+	for _, step := range steps {
+		code, _ := refresh(t, cfg, step.token)
+		if code != step.want {
+			t.Errorf("%s: got status %d, want %d", step.name, code, step.want)
+		}
+	}
+}
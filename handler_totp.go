@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	totpIssuer = "Tubely"
+	// twoFactorChallengeLifetime is how long a user has to enter their code
+	// after entering their password.
+	twoFactorChallengeLifetime = 5 * time.Minute
+	recoveryCodeCount          = 10
+)
+
+var (
+	errSecondFactorMissing = errors.New("a TOTP code or recovery code is required")
+	errInvalidTOTPCode     = errors.New("invalid TOTP code")
+)
+
+// secondFactorParams are accepted wherever a user must prove they have their
+// authenticator app. RecoveryCode is used when they've lost it.
+type secondFactorParams struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// checkSecondFactor verifies the user's TOTP code or spends a recovery code.
+// Each code is only accepted once.
+func (cfg *apiConfig) checkSecondFactor(user database.User, params secondFactorParams) error {
+	switch {
+	case params.Code != "":
+		step, ok := auth.ValidateTOTP(*user.TOTPSecret, params.Code, time.Now())
+		if !ok {
+			return errInvalidTOTPCode
+		}
+		return cfg.db.UseTOTPStep(user.ID, step)
+	case params.RecoveryCode != "":
+		return cfg.db.UseRecoveryCode(user.ID, auth.HashRecoveryCode(params.RecoveryCode))
+	default:
+		return errSecondFactorMissing
+	}
+}
+
+// respondWithSecondFactorError responds to a checkSecondFactor error.
+func respondWithSecondFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errSecondFactorMissing):
+		respondWithError(w, http.StatusBadRequest, "A code or recovery code is required", err)
+	case errors.Is(err, errInvalidTOTPCode),
+		errors.Is(err, database.ErrTOTPCodeUsed),
+		errors.Is(err, database.ErrInvalidRecoveryCode):
+		respondWithError(w, http.StatusUnauthorized, "Invalid code", err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check code", err)
+	}
+}
+
+// respondWithTwoFactorChallenge is handlerLogin's response for users with
+// two-factor authentication: a challenge token for handlerLoginTwoFactor
+// instead of access and refresh tokens.
+func (cfg *apiConfig) respondWithTwoFactorChallenge(w http.ResponseWriter, user database.User) {
+	type response struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+
+	token, err := auth.MakeChallengeJWT(user.ID, cfg.jwtKeys, twoFactorChallengeLifetime)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create challenge token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+	})
+}
+
+// handlerLoginTwoFactor is the second step of logging in with two-factor
+// authentication, responding like handlerLogin once the code checks out.
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		secondFactorParams
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	userID, err := auth.ValidateChallengeJWT(params.ChallengeToken, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge token", err)
+		return
+	}
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil || user.TOTPEnabledAt == nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge token", nil)
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account is disabled", nil)
+		return
+	}
+
+	lockedFor, err := cfg.loginLockedFor(r, user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return
+	}
+	if lockedFor > 0 {
+		respondWithLoginLocked(w, lockedFor)
+		return
+	}
+
+	err = cfg.checkSecondFactor(*user, params.secondFactorParams)
+	if err != nil {
+		if !errors.Is(err, errSecondFactorMissing) {
+			recordErr := cfg.recordLoginFailure(r, user.Email)
+			if recordErr != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't record login attempt", recordErr)
+				return
+			}
+		}
+		respondWithSecondFactorError(w, err)
+		return
+	}
+
+	err = cfg.clearAccountThrottle(user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record login attempt", err)
+		return
+	}
+
+	cfg.respondWithTokens(w, r, *user)
+}
+
+// handlerTOTPEnroll starts two-factor enrollment. The secret only takes
+// effect once handlerTOTPConfirm sees a code generated from it.
+func (cfg *apiConfig) handlerTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	user, err := cfg.db.GetUser(requestPrincipal(r).UserID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	secret, err := auth.MakeTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create secret", err)
+		return
+	}
+	err = cfg.db.SetTOTPSecret(user.ID, secret)
+	if errors.Is(err, database.ErrTOTPAlreadyEnabled) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save secret", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// handlerTOTPConfirm enables two-factor authentication and responds with the
+// recovery codes. They are only ever shown this once.
+func (cfg *apiConfig) handlerTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(requestPrincipal(r).UserID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if user.TOTPSecret == nil {
+		respondWithError(w, http.StatusBadRequest, "Start two-factor enrollment first", nil)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(*user.TOTPSecret, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid code", errInvalidTOTPCode)
+		return
+	}
+
+	codes, err := auth.MakeRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	err = cfg.db.EnableTOTP(user.ID, step, hashes)
+	if errors.Is(err, database.ErrTOTPAlreadyEnabled) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+// handlerTOTPDisable turns two-factor authentication off. It takes a current
+// code so a stolen access token alone can't remove the second factor.
+func (cfg *apiConfig) handlerTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	params := secondFactorParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(requestPrincipal(r).UserID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication isn't enabled", nil)
+		return
+	}
+
+	err = cfg.checkSecondFactor(*user, params)
+	if err != nil {
+		respondWithSecondFactorError(w, err)
+		return
+	}
+
+	err = cfg.db.DisableTOTP(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,42 +3,51 @@ package main
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
-
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
-	"github.com/google/uuid"
+	"time"
 )
 
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+	// get video metadata from db, checking the caller owns it
+	video, ok := cfg.loadOwnedVideo(w, r)
+	if !ok {
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	logger(r.Context()).Info("Uploading thumbnail", "owner_id", video.UserID)
+
+	// quotas are the owner's, even when a moderator uploads
+	usage, err := cfg.db.GetStorageUsage(video.UserID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
 		return
 	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	if !cfg.checkStorageQuota(w, usage, video.ThumbnailSize, 1) {
 		return
 	}
 
-	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
+	// set max thumbnail upload size for the uploader's role
+	limits := cfg.uploadConfig.forRole(requestPrincipal(r).Role)
+	r.Body = http.MaxBytesReader(w, r.Body, limits.maxThumbnailSize)
 
-	// parse multipart data
-	const maxMemory = 10 << 20      // 10 * 2^10 * 2^10 = 10mb, max memory, rest goes to temp disk storage
-	r.ParseMultipartForm(maxMemory) // we decode (parse) file with maxMemory storage set
+	// parse multipart data, thumbnails are small enough to keep in memory
+	uploadStart := time.Now()
+	err = r.ParseMultipartForm(limits.maxThumbnailSize)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large", err)
+			return // early return
+		}
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form", err)
+		return // early return
+	}
 
 	file, fileHeader, err := r.FormFile("thumbnail") // get thumbnail, the type and error
 
@@ -62,35 +71,14 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return                                                                           // early return
 	}
 
-	var fileExt string // init string (for scoping)
-
-	// only allow jpeg and png
-	switch mediaType {
-	case "image/jpeg": // if jpeg
-		fileExt = ".jpg" // set ext accordingly
-	case "image/png": // if png
-		fileExt = ".png" // set ext accordingly
-	default: // if ANYTHING else
+	// only allow the configured types
+	fileExt, ok := limits.thumbnailTypes[mediaType]
+	if !ok {
 		errorMessage := fmt.Sprintf("Invalid thumbnail type: %s", mediaType) // custom msg
 		respondWithError(w, http.StatusBadRequest, errorMessage, nil)        // nil, not an error
 		return                                                               // early return
 	}
 
-	// get video metadata from db
-	video, err := cfg.db.GetVideo(videoID)
-
-	// get video check
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
-		return // early return
-	}
-
-	// authorisation check using apiConfig
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "You can't upload a thumbnail for this video", nil) // no sys err
-		return                                                                                           // early return
-	}
-
 	// generate random 32-byte slice for filename
 	randomBytes := make([]byte, 32) // init a slice
 	rand.Read(randomBytes)          // generate here
@@ -113,13 +101,17 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	}
 
 	// copy imageData contents to this new empty file
-	_, err = io.Copy(outFile, file) // write filedata to outFile
+	thumbnailSize, err := io.Copy(outFile, file) // write filedata to outFile
 
 	// io.Copy check
 	if err != nil {
+		// don't leave a partial thumbnail behind in assets
+		outFile.Close()
+		os.Remove(filePath)
 		respondWithError(w, http.StatusInternalServerError, "Error copying thumbnail data to file", err)
 		return // early return
 	}
+	observeUpload("thumbnail", thumbnailSize, time.Since(uploadStart))
 
 	// close file and outFile os/io reading on func end, prevent mem leak
 	defer outFile.Close()
@@ -127,10 +119,24 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	// build the thumbnail path (filesystem)
 	thumbnailURL := fmt.Sprintf("http://localhost:%s/assets/%s%s", cfg.port, randomName, fileExt) // path of file on filesystem
 
-	// update the video thumbnail DATA url path
-	video.ThumbnailURL = &thumbnailURL // note it's a pointer field (write to field)
-	updatedVideo := cfg.db.UpdateVideo(video)
+	// store the thumbnail url if it fits in the owner's quota
+	replacedURL, err := cfg.db.SetThumbnailFile(video.ID, thumbnailURL, thumbnailSize, cfg.storageQuota.limits())
+
+	// update check
+	if err != nil {
+		os.Remove(filePath)
+		cfg.respondWithStoreFileError(w, err)
+		return // early return
+	}
+
+	// the old thumbnail is no longer used
+	if replacedURL != nil {
+		err = cfg.deleteThumbnailFile(*replacedURL)
+		if err != nil {
+			logger(r.Context()).Error("Couldn't delete replaced thumbnail", "url", *replacedURL, "error", err)
+		}
+	}
 
-	// respond to client with the updated video struct
-	respondWithJSON(w, http.StatusOK, updatedVideo)
+	// respond to client with the updated video
+	cfg.respondWithVideo(w, video.ID)
 }
@@ -4,20 +4,24 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
-	"github.com/google/uuid"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 // Structs
@@ -31,59 +35,39 @@ type FFProbeStream struct {
 }
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID") // for extracting videoID from URL path
-
-	// parse the string as a UUID
-	videoID, err := uuid.Parse(videoIDString)
-
-	// uuid parse check
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+	// get video metadata from db, checking the caller owns it
+	video, ok := cfg.loadOwnedVideo(w, r)
+	if !ok {
 		return
 	}
 
-	// get JWT token
-	token, err := auth.GetBearerToken(r.Header)
+	// server log
+	logger(r.Context()).Info("Uploading video", "owner_id", video.UserID)
 
-	// missing JWT check
+	// quotas are the owner's, even when a moderator uploads
+	usage, err := cfg.db.GetStorageUsage(video.UserID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
 		return
 	}
-
-	// validate user with JWT
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-
-	// validation check
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	if !cfg.checkVideoUpload(w, usage, video) {
 		return
 	}
 
-	// server log
-	fmt.Println("uploading video", videoID, "by user", userID)
+	// set max video upload size for the uploader's role
+	limits := cfg.uploadConfig.forRole(requestPrincipal(r).Role)
+	r.Body = http.MaxBytesReader(w, r.Body, limits.maxVideoSize)
 
-	// get video metadata from db
-	video, err := cfg.db.GetVideo(videoID)
-
-	// get video check
+	// stream the form rather than parsing it all up front, so the video is
+	// written to disk once instead of being buffered by ParseMultipartForm first
+	reader, err := r.MultipartReader()
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form", err)
 		return // early return
 	}
 
-	// authorisation check using apiConfig
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "You can't upload a video for this user", nil) // no sys err
-		return                                                                                      // early return
-	}
-
-	// set max video upload size
-	const maxUploadSize = 1 << 30 // 1 * 2^30 = 1gb, max size
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-
-	// we decode (parse) file with max upload size set
-	err = r.ParseMultipartForm(maxUploadSize)
+	// get the video part, skipping any fields before it
+	part, err := nextFormFile(reader, "video")
 
 	// form file get check
 	if err != nil {
@@ -96,22 +80,13 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		}
 
 		// continue with general error check
-		respondWithError(w, http.StatusBadRequest, "Unable to parse form", err)
-		return // early return
-	}
-
-	// get video, the type and error
-	file, fileHeader, err := r.FormFile("video")
-
-	// form file get check
-	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Unable to parse multipart form file", err)
 		return // early return
 	}
-	defer file.Close() // stop reading when done, prevent mem leak
+	defer part.Close() // stop reading when done, prevent mem leak
 
 	// get the video media type
-	mediaContentType := fileHeader.Header.Get("Content-Type") // mp4 etc from fileHeader
+	mediaContentType := part.Header.Get("Content-Type") // mp4 etc from the part header
 
 	// get MIME extension via parsing
 	mediaType, _, err := mime.ParseMediaType(mediaContentType) // pass in header content type, ignore params
@@ -123,13 +98,9 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return                                                                           // early return
 	}
 
-	var fileExt string // init string (for scoping)
-
-	// only allow mp4
-	switch mediaType {
-	case "video/mp4": // if mp4
-		fileExt = ".mp4" // set ext accordingly
-	default: // if ANYTHING else
+	// only allow the configured types
+	fileExt, ok := limits.videoTypes[mediaType]
+	if !ok {
 		errorMessage := fmt.Sprintf("Invalid video type: %s", mediaType) // custom msg
 		respondWithError(w, http.StatusBadRequest, errorMessage, nil)    // nil, not an error
 		return                                                           // early return
@@ -152,24 +123,26 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}()
 	// if separate defer lines, remove BEFORE close, otherwise remove will run first! LIFO defer!
 
-	// copy contents for wire (http req) to temp file
-	_, err = io.Copy(tempFile, file) // write filedata to tempFile
+	// copy contents from the wire (http req) to temp file, hashing and counting as it goes
+	hash := sha256.New()
+	uploadStart := time.Now()
+	uploadSize, err := io.Copy(io.MultiWriter(tempFile, hash), part)
 
 	// io.Copy check
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large", err)
+			return // early return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Error copying video data to file", err)
 		return // early return
 	}
+	uploadHash := hex.EncodeToString(hash.Sum(nil))
+	observeUpload("video", uploadSize, time.Since(uploadStart))
 
-	// reset tempFile pointer to start (after io.Copy)
-	_, err = tempFile.Seek(0, io.SeekStart)
-	// set position 0, relative from file start
-
-	// reset ptr check
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error resetting temp file pointer", err)
-		return // early return
-	}
+	// server log
+	logger(r.Context()).Info("Received video", "bytes", uploadSize, "sha256", uploadHash)
 
 	// generate random 32-byte slice for filename
 	randomBytes := make([]byte, 32) // init a slice
@@ -180,7 +153,11 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	tempFilePath := tempFile.Name() // .Name() gets the /tmp/filename.ext file path
 
 	// process video for fast start
-	processedFilePath, err := processVideoForFastStart(tempFilePath)
+	// NOTE: ffmpeg needs to seek in both the upload (its moov atom may be at
+	// the end) and its output (faststart rewrites the file once written), so
+	// it can't stream, and while it runs the upload and the processed copy
+	// are both on disk: peak disk use is about twice the video's size
+	processedFilePath, err := processVideoForFastStart(r.Context(), tempFilePath)
 
 	// process check
 	if err != nil {
@@ -189,6 +166,11 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 	defer os.Remove(processedFilePath) // clean up after to prevent mem leak
 
+	// the upload isn't needed once processed, remove it now rather than
+	// keeping both copies until the S3 upload is done
+	tempFile.Close()
+	os.Remove(tempFilePath)
+
 	// open the processed file (for S3 upload & AR get)
 	processedFile, err := os.Open(processedFilePath)
 
@@ -199,8 +181,18 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 	defer processedFile.Close() // prevent mem leak
 
+	// check the stored size against the owner's quota
+	processedInfo, err := processedFile.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error reading processed file", err)
+		return
+	}
+	if !cfg.checkStorageQuota(w, usage, video.VideoSize, processedInfo.Size()) {
+		return
+	}
+
 	// get aspect ratio (from processed file)
-	aspectRatio, err := getVideoAspectRatio(processedFilePath) // pass tmp filepath to helper
+	aspectRatio, err := getVideoAspectRatio(r.Context(), processedFilePath) // pass tmp filepath to helper
 
 	// aspect ratio check
 	if err != nil {
@@ -208,6 +200,15 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return // early return
 	}
 
+	// get duration in seconds (from processed file)
+	duration, err := getVideoDuration(r.Context(), processedFilePath)
+
+	// duration check
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting video duration", err)
+		return // early return
+	}
+
 	// determine aspect ratio prefix (init before to enter switch scope)
 	var aspectRatioPrefix string
 
@@ -228,15 +229,18 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	// create S3 put object parameters
 	putParams := &s3.PutObjectInput{
-		Bucket:      aws.String(cfg.s3Bucket),     // bucket from .env
-		Key:         aws.String(fileKey),          // oue new filename
-		Body:        processedFile,                // io.Reader
-		ContentType: aws.String(mediaContentType), // extension
+		Bucket:      aws.String(cfg.s3Bucket), // bucket from .env
+		Key:         aws.String(fileKey),      // oue new filename
+		Body:        processedFile,            // io.Reader
+		ContentType: aws.String("video/mp4"),  // processed videos are always mp4
+		Metadata: map[string]string{
+			"upload-sha256": uploadHash, // checksum of the file as uploaded, before processing
+		},
 	}
 	// aws.String() cnvrts string to *string - AWS needs pointers to omit fields by passing nil
 
 	// UPLOAD (put) the VIDEO (object) into S3 (SERVERLESS STORAGE BUCKET)
-	_, err = cfg.s3Client.PutObject(context.Background(), putParams)
+	err = cfg.putS3Object(r.Context(), putParams)
 
 	// put check
 	if err != nil {
@@ -248,23 +252,55 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	videoURL := fmt.Sprintf("%s/%s", cfg.s3CfDistribution, fileKey) // standard /
 	// store distribution domain + fileKey to use CloudFront
 
-	// update the video thumbnail DATA url path
-	video.VideoURL = &videoURL      // note it's a pointer field (write to field)
-	err = cfg.db.UpdateVideo(video) // update our DB VideoURL with S3 path
-	// NOTE: UpdateVideo ONLY returns err
+	// store the video url & probe results (for listing filters & sorting) if it fits in the owner's quota
+	replacedURL, err := cfg.db.SetVideoFile(database.SetVideoFileParams{
+		VideoID:     video.ID,
+		URL:         videoURL,
+		Size:        processedInfo.Size(),
+		AspectRatio: &aspectRatio,
+		Duration:    &duration,
+	}, cfg.storageQuota.limits())
 
 	// update video in DB check
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error updating video in DB", err)
-		return // early return)
+		// nothing refers to the new object, don't leave it taking up space
+		deleteErr := cfg.deleteVideoFile(r.Context(), videoURL)
+		if deleteErr != nil {
+			logger(r.Context()).Error("Couldn't delete rejected video", "url", videoURL, "error", deleteErr)
+		}
+		cfg.respondWithStoreFileError(w, err)
+		return // early return
+	}
+
+	// the old video file is no longer used
+	if replacedURL != nil {
+		err = cfg.deleteVideoFile(r.Context(), *replacedURL)
+		if err != nil {
+			logger(r.Context()).Error("Couldn't delete replaced video", "url", *replacedURL, "error", err)
+		}
 	}
 
-	// respond to client with the updated video struct
-	respondWithJSON(w, http.StatusOK, video)
+	// respond to client with the updated video
+	cfg.respondWithVideo(w, video.ID)
 }
 
 // HELPER FUNCTIONS
-func getVideoAspectRatio(filePath string) (string, error) {
+
+// nextFormFile reads the multipart form up to the part for the named field,
+// discarding any parts before it. It returns io.EOF if there is no such part.
+func nextFormFile(reader *multipart.Reader, field string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+func getVideoAspectRatio(ctx context.Context, filePath string) (string, error) {
 	// execute ffprobe command
 	cmd := exec.Command(
 		"ffprobe",
@@ -279,7 +315,7 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	cmd.Stdout = &out    // store cmd output to this in-memory byte slice
 
 	// run the cmd
-	err := cmd.Run() // out.Bytes() contains the stdout of ffprobe
+	err := runMediaCommand(ctx, cmd) // out.Bytes() contains the stdout of ffprobe
 	// this "runs" the cmd, with output in the buffer, ready for parsing etc
 
 	// run check
@@ -320,7 +356,40 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	}
 }
 
-func processVideoForFastStart(filePath string) (string, error) {
+func getVideoDuration(ctx context.Context, filePath string) (float64, error) {
+	// execute ffprobe command, printing only the container duration
+	cmd := exec.Command(
+		"ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		filePath,
+	)
+
+	// direct output to bytes.Buffer
+	var out bytes.Buffer // hold cmd output
+	cmd.Stdout = &out    // store cmd output to this in-memory byte slice
+
+	// run the cmd
+	err := runMediaCommand(ctx, cmd)
+
+	// run check
+	if err != nil {
+		return 0, err // error is returned upwards ie to handler
+	}
+
+	// output is the duration in seconds, eg "12.345000"
+	duration, err := strconv.ParseFloat(strings.TrimSpace(out.String()), 64)
+
+	// parse check
+	if err != nil {
+		return 0, fmt.Errorf("error parsing duration %q: %w", out.String(), err)
+	}
+
+	return duration, nil
+}
+
+func processVideoForFastStart(ctx context.Context, filePath string) (string, error) {
 	// output file path
 	outFilePath := filePath + ".processing"
 
@@ -343,7 +412,7 @@ func processVideoForFastStart(filePath string) (string, error) {
 	cmd.Stderr = &stderr    // store cmd error to this in-memory byte slice
 
 	// run the cmd
-	err := cmd.Run() // out.Bytes() contains the stdout of ffmpeg
+	err := runMediaCommand(ctx, cmd) // out.Bytes() contains the stdout of ffmpeg
 	// this "runs" the cmd, with output in the buffer, ready for parsing etc
 
 	// run check
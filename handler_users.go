@@ -21,11 +21,17 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
+	params.Email = normalizeEmail(params.Email)
 
 	if params.Password == "" || params.Email == "" {
 		respondWithError(w, http.StatusBadRequest, "Email and password are required", nil)
 		return
 	}
+	err = validateEmail(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", err)
+		return
+	}
 
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
@@ -42,5 +48,11 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// the user exists either way, and can ask for the email again
+	err = cfg.sendVerificationEmail(*user)
+	if err != nil {
+		logger(r.Context()).Error("Couldn't send verification email", "user_id", user.ID, "error", err)
+	}
+
 	respondWithJSON(w, http.StatusCreated, user)
 }
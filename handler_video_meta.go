@@ -2,9 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
@@ -14,65 +20,97 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		database.CreateVideoParams
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
+	userID := requestPrincipal(r).UserID
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
 	params.UserID = userID
 
+	err = validateVideoMetadata(params.Title, params.Description)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
 	}
+	withLogVideo(r.Context(), video.ID)
 
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
-func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+// handlerVideoMetaUpdate applies a partial title/description update. Clients
+// may send If-Match with the ETag from a previous read to avoid lost updates.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+	}
+
+	video, ok := cfg.loadOwnedVideo(w, r)
+	if !ok {
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Title == nil && params.Description == nil {
+		respondWithError(w, http.StatusBadRequest, "Nothing to update", nil)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+
+	if !etagMatches(r.Header.Get("If-Match"), videoETag(video)) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has been modified since it was last fetched", nil)
+		return
+	}
+
+	if params.Title != nil {
+		video.Title = strings.TrimSpace(*params.Title)
+	}
+	if params.Description != nil {
+		video.Description = *params.Description
+	}
+	err = validateVideoMetadata(video.Title, video.Description)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	updated, err := cfg.db.UpdateVideoIfVersion(video)
+	if errors.Is(err, database.ErrVideoVersionConflict) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has been modified since it was last fetched", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
+
+	w.Header().Set("ETag", videoETag(updated))
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadOwnedVideo(w, r)
+	if !ok {
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	// deleting moves the video to the trash; runTrashPurger removes it for good later
+	err := cfg.db.TrashVideo(video.ID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -94,27 +132,148 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
 
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusOK, video)
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	userID := requestPrincipal(r).UserID
+
+	params, err := parseGetVideosParams(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	params.UserID = userID
+
+	page, err := cfg.db.GetVideos(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if errors.Is(err, database.ErrInvalidTag) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
-
-	videos, err := cfg.db.GetVideos(userID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// parseGetVideosParams reads the sort, pagination and filter query parameters of GET /api/videos.
+func parseGetVideosParams(r *http.Request) (database.GetVideosParams, error) {
+	query := r.URL.Query()
+	params := database.GetVideosParams{
+		Sort:        database.VideoSort(query.Get("sort")),
+		Cursor:      query.Get("cursor"),
+		AspectRatio: query.Get("aspect_ratio"),
+		Tags:        query["tag"],
+	}
+
+	if params.Sort != "" && !params.Sort.Valid() {
+		return params, fmt.Errorf("invalid sort %q, expected newest, oldest, title or duration", params.Sort)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > database.MaxVideoPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", database.MaxVideoPageSize)
+		}
+		params.Limit = n
+	}
+
+	switch params.AspectRatio {
+	case "", "16:9", "9:16", "other":
+	default:
+		return params, fmt.Errorf("invalid aspect_ratio %q, expected 16:9, 9:16 or other", params.AspectRatio)
+	}
+
+	var err error
+	if params.HasVideo, err = parseBoolQuery(query, "has_video"); err != nil {
+		return params, err
+	}
+	if params.HasThumbnail, err = parseBoolQuery(query, "has_thumbnail"); err != nil {
+		return params, err
+	}
+	if params.CreatedAfter, err = parseTimeQuery(query, "created_after"); err != nil {
+		return params, err
+	}
+	if params.CreatedBefore, err = parseTimeQuery(query, "created_before"); err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
+
+func parseBoolQuery(query url.Values, key string) (*bool, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+	return &b, nil
+}
+
+// parseTimeQuery accepts either an RFC 3339 timestamp or a plain YYYY-MM-DD date (midnight UTC).
+func parseTimeQuery(query url.Values, key string) (*time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or YYYY-MM-DD date", key)
+}
+
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 5000
+)
+
+func validateVideoMetadata(title, description string) error {
+	if strings.TrimSpace(title) == "" {
+		return errors.New("Title is required")
+	}
+	if utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return fmt.Errorf("Title must be at most %d characters", maxVideoTitleLength)
+	}
+	if utf8.RuneCountInString(description) > maxVideoDescriptionLength {
+		return fmt.Errorf("Description must be at most %d characters", maxVideoDescriptionLength)
+	}
+	return nil
+}
+
+// videoETag identifies a revision of a video; it changes on every update.
+func videoETag(video database.Video) string {
+	return fmt.Sprintf(`"%d"`, video.Version)
+}
+
+// etagMatches reports whether an If-Match header allows the write. An absent
+// header always matches.
+func etagMatches(ifMatch, etag string) bool {
+	if ifMatch == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
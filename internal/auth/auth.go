@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -18,9 +19,26 @@ type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "tubely-access"
+	// TokenTypeTwoFactorChallenge tokens show that a user entered their
+	// password but still has to enter a TOTP code. They aren't access tokens.
+	TokenTypeTwoFactorChallenge TokenType = "tubely-2fa-challenge"
 )
 
-var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
+// API key scopes. Keys may only act within the scopes they were created with.
+const (
+	ScopeVideosRead  = "videos:read"
+	ScopeVideosWrite = "videos:write"
+)
+
+// APIKeyScopes lists every scope an API key can be granted.
+var APIKeyScopes = []string{ScopeVideosRead, ScopeVideosWrite}
+
+const apiKeyPrefix = "tubely_"
+
+var (
+	ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
+	ErrMalformedAuthHeader  = errors.New("malformed authorization header")
+)
 
 func HashPassword(password string) (string, error) {
 	dat, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -34,50 +52,83 @@ func CheckPasswordHash(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
+// accessClaims are the claims of an access token. Role is informational for
+// clients; the server authorizes against the user's current stored role.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
+}
+
 func MakeJWT(
 	userID uuid.UUID,
-	tokenSecret string,
+	role string,
+	keys *KeySet,
 	expiresIn time.Duration,
 ) (string, error) {
-	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+	return keys.sign(accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeAccess),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Role: role,
 	})
-	return token.SignedString(signingKey)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
+// ValidateJWT returns the user ID and role carried by a valid access token.
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, string, error) {
+	claimsStruct := accessClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		keys.keyFunc,
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, "", err
 	}
 
 	userIDString, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, "", err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, "", err
 	}
 	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+		return uuid.Nil, "", errors.New("invalid issuer")
 	}
 
 	id, err := uuid.Parse(userIDString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return uuid.Nil, "", fmt.Errorf("invalid user ID: %w", err)
 	}
-	return id, nil
+	return id, claimsStruct.Role, nil
+}
+
+// MakeChallengeJWT returns a TokenTypeTwoFactorChallenge token for the user.
+func MakeChallengeJWT(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return keys.sign(jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeTwoFactorChallenge),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+	})
+}
+
+// ValidateChallengeJWT returns the user ID of a valid challenge token.
+func ValidateChallengeJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, keys.keyFunc)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if claims.Issuer != string(TokenTypeTwoFactorChallenge) {
+		return uuid.Nil, errors.New("invalid issuer")
+	}
+	return uuid.Parse(claims.Subject)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -87,7 +138,7 @@ func GetBearerToken(headers http.Header) (string, error) {
 	}
 	splitAuth := strings.Split(authHeader, " ")
 	if len(splitAuth) < 2 || splitAuth[0] != "Bearer" {
-		return "", errors.New("malformed authorization header")
+		return "", ErrMalformedAuthHeader
 	}
 
 	return splitAuth[1], nil
@@ -109,8 +160,43 @@ func GetAPIKey(headers http.Header) (string, error) {
 	}
 	splitAuth := strings.Split(authHeader, " ")
 	if len(splitAuth) < 2 || splitAuth[0] != "ApiKey" {
-		return "", errors.New("malformed authorization header")
+		return "", ErrMalformedAuthHeader
 	}
 
 	return splitAuth[1], nil
 }
+
+// MakeAPIKey returns a new random API key. Only its hash should be stored.
+func MakeAPIKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(key), nil
+}
+
+// HashAPIKey returns the value stored in place of key. API keys are long and
+// random, so a fast unsalted hash is enough and allows lookup by hash.
+func HashAPIKey(key string) string {
+	return HashToken(key)
+}
+
+// MakePasswordResetToken returns a new random reset token. Only its hash
+// should be stored.
+func MakePasswordResetToken() (string, error) {
+	return MakeRefreshToken()
+}
+
+// MakeEmailVerificationToken returns a new random token proving ownership of
+// an email address. Only its hash should be stored.
+func MakeEmailVerificationToken() (string, error) {
+	return MakeRefreshToken()
+}
+
+// HashToken returns the value stored in place of a long random token, such
+// as an API key or password reset token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// the SHA1 secret "12345678901234567890" from RFC 6238 appendix B, whose
+	// 8 digit codes end in the 6 digit ones
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	at := func(unix int64) time.Time { return time.Unix(unix, 0) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      time.Time
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "rfc vector 59", secret: secret, code: "287082", now: at(59), wantStep: 1, wantOK: true},
+		{name: "rfc vector 1111111109", secret: secret, code: "081804", now: at(1111111109), wantStep: 37037036, wantOK: true},
+		{name: "rfc vector 1234567890", secret: secret, code: "005924", now: at(1234567890), wantStep: 41152263, wantOK: true},
+		{name: "rfc vector 2000000000", secret: secret, code: "279037", now: at(2000000000), wantStep: 66666666, wantOK: true},
+		{name: "previous step", secret: secret, code: "287082", now: at(89), wantStep: 1, wantOK: true},
+		{name: "next step", secret: secret, code: "287082", now: at(29), wantStep: 1, wantOK: true},
+		{name: "two steps late", secret: secret, code: "287082", now: at(120)},
+		{name: "spaces ignored", secret: secret, code: "287 082", now: at(59), wantStep: 1, wantOK: true},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "287082", now: at(59), wantStep: 1, wantOK: true},
+		{name: "wrong code", secret: secret, code: "287083", now: at(59)},
+		{name: "too short", secret: secret, code: "28708", now: at(59)},
+		{name: "8 digit code", secret: secret, code: "94287082", now: at(59)},
+		{name: "invalid secret", secret: "not base32!", code: "287082", now: at(59)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tc.secret, tc.code, tc.now)
+			if ok != tc.wantOK || step != tc.wantStep {
+				t.Errorf("ValidateTOTP() = %d, %v, want %d, %v", step, ok, tc.wantStep, tc.wantOK)
+			}
+		})
+	}
+}
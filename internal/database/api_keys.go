@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreateAPIKeyParams
+}
+
+type CreateAPIKeyParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+	KeyHash   string    `json:"-"`
+	KeyPrefix string    `json:"prefix"`
+	Scopes    []string  `json:"scopes"`
+	// ExpiresAt is nil for keys that never expire.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+const apiKeyColumns = `
+		id,
+		created_at,
+		last_used_at,
+		user_id,
+		name,
+		key_hash,
+		key_prefix,
+		scopes,
+		expires_at`
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	err := row.Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.UserID,
+		&key.Name,
+		&key.KeyHash,
+		&key.KeyPrefix,
+		&scopes,
+		&key.ExpiresAt,
+	)
+	key.Scopes = strings.Fields(scopes)
+	return key, err
+}
+
+func (c Client) CreateAPIKey(params CreateAPIKeyParams) (APIKey, error) {
+	id := uuid.New()
+	var expiresAt any
+	if params.ExpiresAt != nil {
+		expiresAt = c.dialect.timeArg(*params.ExpiresAt)
+	}
+	query := `
+	INSERT INTO api_keys (
+		id,
+		created_at,
+		user_id,
+		name,
+		key_hash,
+		key_prefix,
+		scopes,
+		expires_at
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.exec(
+		query,
+		id,
+		params.UserID,
+		params.Name,
+		params.KeyHash,
+		params.KeyPrefix,
+		strings.Join(params.Scopes, " "),
+		expiresAt,
+	)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return scanAPIKey(c.queryRow("SELECT"+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+}
+
+// GetAPIKeys lists a user's API keys, newest first.
+func (c Client) GetAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	FROM api_keys
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC
+	`
+	rows, err := c.query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash returns the key with the given hash, or a zero APIKey if
+// there is none. Callers must still check expiry and scopes.
+func (c Client) GetAPIKeyByHash(keyHash string) (APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	FROM api_keys
+	WHERE key_hash = ?
+	`
+	key, err := scanAPIKey(c.queryRow(query, keyHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIKey{}, nil
+		}
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+func (c Client) TouchAPIKey(id uuid.UUID) error {
+	_, err := c.exec("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return err
+}
+
+// DeleteAPIKey revokes one of the user's keys, returning ErrAPIKeyNotFound if
+// they have no key with that ID.
+func (c Client) DeleteAPIKey(userID, id uuid.UUID) error {
+	result, err := c.exec("DELETE FROM api_keys WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -2,88 +2,187 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Client is the SQL-backed Store used for both SQLite and Postgres.
+// Queries are written with ? placeholders and rebound for the active dialect.
 type Client struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect
+	observe QueryObserver
+	// fts5 is whether SQLite was built with full-text search; see syncSearchIndex.
+	fts5 bool
 }
 
+// QueryObserver is told how long each query took and whether it failed.
+// operation is the query's first keyword, like "select" or "update".
+// Statements run inside transactions aren't observed.
+type QueryObserver func(operation string, d time.Duration, err error)
+
+// WithQueryObserver returns a copy of c that reports its queries to observe.
+func (c Client) WithQueryObserver(observe QueryObserver) Client {
+	c.observe = observe
+	return c
+}
+
+// NewClient opens (and creates if needed) the SQLite database at pathToDB.
+// Call MigrateUp before using a fresh database.
 func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+	// SQLite leaves foreign keys off unless every connection asks for them
+	sep := "?"
+	if strings.Contains(pathToDB, "?") {
+		sep = "&"
+	}
+	return newClient(dialectSQLite, pathToDB+sep+"_foreign_keys=on")
+}
+
+// NewPostgresClient connects to the Postgres database described by dbURL.
+func NewPostgresClient(dbURL string) (Client, error) {
+	return newClient(dialectPostgres, dbURL)
+}
+
+func newClient(d dialect, dataSourceName string) (Client, error) {
+	db, err := sql.Open(d.driverName(), dataSourceName)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	err = db.Ping()
 	if err != nil {
-		return Client{}, err
+		db.Close()
+		return Client{}, fmt.Errorf("failed to connect to %s database: %w", d, err)
+	}
+
+	c := Client{db: db, dialect: d}
+	if d == dialectSQLite {
+		err = db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&c.fts5)
+		if err != nil {
+			db.Close()
+			return Client{}, err
+		}
 	}
 	return c, nil
+}
 
+func (c Client) Close() error {
+	return c.db.Close()
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
+func (c Client) exec(query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	result, err := c.db.Exec(c.dialect.rebind(query), args...)
+	c.observeQuery(query, start, err)
+	return result, err
+}
+
+func (c Client) query(query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := c.db.Query(c.dialect.rebind(query), args...)
+	c.observeQuery(query, start, err)
+	return rows, err
+}
+
+func (c Client) queryRow(query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := c.db.QueryRow(c.dialect.rebind(query), args...)
+	err := row.Err()
+	if errors.Is(err, sql.ErrNoRows) {
+		// not finding anything isn't a failed query
+		err = nil
+	}
+	c.observeQuery(query, start, err)
+	return row
+}
+
+func (c Client) observeQuery(query string, start time.Time, err error) {
+	if c.observe == nil {
+		return
+	}
+	d := time.Since(start)
+	operation := ""
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToLower(fields[0])
+	}
+	c.observe(operation, d, err)
+}
+
+// Reset deletes every row of every table the migrations created, leaving
+// the schema and its recorded migrations in place.
+func (c Client) Reset() error {
+	tables, err := c.dataTables()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to list tables: %w", err)
 	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
+	if len(tables) == 0 {
+		return nil
+	}
+
+	if c.dialect == dialectPostgres {
+		_, err = c.exec("TRUNCATE " + strings.Join(tables, ", ") + " CASCADE")
+		if err != nil {
+			return fmt.Errorf("failed to reset tables: %w", err)
+		}
+		return nil
+	}
+
+	tx, err := c.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
+	// rows may reference each other in any order until the commit
+	_, err = tx.Exec("PRAGMA defer_foreign_keys = ON")
 	if err != nil {
 		return err
 	}
-	return nil
+	for _, table := range tables {
+		_, err = tx.Exec("DELETE FROM " + table)
+		if err != nil {
+			return fmt.Errorf("failed to reset table %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
-		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
+// dataTables lists the tables holding application data: everything but
+// schema_migrations and, in SQLite, its internal tables and the full-text
+// index, which triggers keep in step with videos.
+func (c Client) dataTables() ([]string, error) {
+	query := `
+	SELECT name FROM pragma_table_list
+	WHERE schema = 'main' AND type = 'table'
+		AND name NOT LIKE 'sqlite%' AND name <> 'schema_migrations'
+	ORDER BY name
+	`
+	if c.dialect == dialectPostgres {
+		query = `
+		SELECT tablename FROM pg_tables
+		WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'
+		ORDER BY tablename
+		`
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+
+	rows, err := c.query(query)
+	if err != nil {
+		return nil, err
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
-		return fmt.Errorf("failed to reset table videos: %w", err)
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
 	}
-	return nil
+	return tables, rows.Err()
 }
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for a fresh, migrated SQLite database.
+func newTestClient(t *testing.T) Client {
+	t.Helper()
+	c, err := NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	err = c.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestReset(t *testing.T) {
+	c := newTestClient(t)
+	user, err := c.CreateUser(CreateUserParams{Email: "user@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := c.CreateVideo(CreateVideoParams{Title: "video", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.AddVideoTags(video, []string{"tag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreatePlaylist(CreatePlaylistParams{Title: "playlist", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateRefreshToken(CreateRefreshTokenParams{Token: "token", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Reset()
+	if err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+
+	tables, err := c.dataTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range append(tables, "videos_fts") {
+		if table == "videos_fts" && !c.fts5 {
+			continue
+		}
+		var count int
+		err = c.queryRow("SELECT COUNT(*) FROM " + table).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%s has %d rows after Reset", table, count)
+		}
+	}
+
+	var migrations int
+	err = c.queryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrations == 0 {
+		t.Error("Reset removed the recorded migrations")
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type dialect string
+
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+const (
+	dialectSQLite   dialect = "sqlite"
+	dialectPostgres dialect = "postgres"
+)
+
+func (d dialect) driverName() string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite3"
+}
+
+func (d dialect) timestampType() string {
+	if d == dialectPostgres {
+		return "TIMESTAMPTZ"
+	}
+	return "TIMESTAMP"
+}
+
+// timeArg converts t into a value that compares correctly against timestamp
+// columns. SQLite stores CURRENT_TIMESTAMP as "YYYY-MM-DD HH:MM:SS" text in UTC.
+func (d dialect) timeArg(t time.Time) any {
+	if d == dialectPostgres {
+		return t
+	}
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// rebind rewrites ? placeholders into the $1, $2, ... form Postgres expects.
+// A ? inside a quoted string or identifier is left alone.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// a doubled quote inside a quoted section ends and reopens it,
+			// so toggling is enough to handle escapes
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package database
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect dialect
+		query   string
+		want    string
+	}{
+		{
+			name:    "sqlite unchanged",
+			dialect: dialectSQLite,
+			query:   "SELECT * FROM videos WHERE id = ? AND user_id = ?",
+			want:    "SELECT * FROM videos WHERE id = ? AND user_id = ?",
+		},
+		{
+			name:    "postgres numbered",
+			dialect: dialectPostgres,
+			query:   "SELECT * FROM videos WHERE id = ? AND user_id = ?",
+			want:    "SELECT * FROM videos WHERE id = $1 AND user_id = $2",
+		},
+		{
+			name:    "postgres past nine",
+			dialect: dialectPostgres,
+			query:   "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			want:    "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		},
+		{
+			name:    "postgres no placeholders",
+			dialect: dialectPostgres,
+			query:   "SELECT COUNT(*) FROM videos",
+			want:    "SELECT COUNT(*) FROM videos",
+		},
+		{
+			name:    "postgres quoted string",
+			dialect: dialectPostgres,
+			query:   "SELECT 'why?' WHERE title = ? AND description <> 'it''s ok?'",
+			want:    "SELECT 'why?' WHERE title = $1 AND description <> 'it''s ok?'",
+		},
+		{
+			name:    "postgres quoted identifier",
+			dialect: dialectPostgres,
+			query:   `SELECT "odd?column" FROM videos WHERE id = ?`,
+			want:    `SELECT "odd?column" FROM videos WHERE id = $1`,
+		},
+		{
+			name:    "postgres multibyte text",
+			dialect: dialectPostgres,
+			query:   "SELECT 'héllo' WHERE title = ?",
+			want:    "SELECT 'héllo' WHERE title = $1",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.dialect.rebind(tc.query)
+			if got != tc.want {
+				t.Errorf("rebind(%q) = %q, want %q", tc.query, got, tc.want)
+			}
+		})
+	}
+}
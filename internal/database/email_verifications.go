@@ -0,0 +1,63 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidVerificationToken = errors.New("email verification token is invalid, expired or already used")
+
+type CreateEmailVerificationTokenParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (c Client) CreateEmailVerificationToken(params CreateEmailVerificationTokenParams) error {
+	query := `
+	INSERT INTO email_verification_tokens (token_hash, user_id, created_at, expires_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP, ?)
+	`
+	_, err := c.exec(query, params.TokenHash, params.UserID.String(), c.dialect.timeArg(params.ExpiresAt))
+	return err
+}
+
+// VerifyEmail uses up the token and marks its user's email verified,
+// returning ErrInvalidVerificationToken if the token can't be used.
+func (c Client) VerifyEmail(tokenHash string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(c.dialect.rebind(`
+		UPDATE email_verification_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+	`), tokenHash, c.dialect.timeArg(time.Now()))
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidVerificationToken
+	}
+
+	_, err = tx.Exec(c.dialect.rebind(`
+		UPDATE users
+		SET email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT user_id FROM email_verification_tokens WHERE token_hash = ?)
+			AND email_verified_at IS NULL
+	`), tokenHash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCState is a login started with an OpenID Connect provider, kept until the
+// provider redirects back to the callback.
+type OIDCState struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+// CreateOIDCState stores a pending login, clearing out abandoned ones.
+func (c Client) CreateOIDCState(state OIDCState) error {
+	_, err := c.exec("DELETE FROM oidc_states WHERE expires_at <= ?", c.dialect.timeArg(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO oidc_states (state, code_verifier, nonce, created_at, expires_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?)
+	`
+	_, err = c.exec(query, state.State, state.CodeVerifier, state.Nonce, c.dialect.timeArg(state.ExpiresAt))
+	return err
+}
+
+// ConsumeOIDCState removes and returns a pending login so it can't be
+// replayed. It returns a zero OIDCState if the state is unknown, expired or
+// was already used.
+func (c Client) ConsumeOIDCState(state string) (OIDCState, error) {
+	query := `
+	SELECT state, code_verifier, nonce, expires_at
+	FROM oidc_states
+	WHERE state = ?
+	`
+	var s OIDCState
+	err := c.queryRow(query, state).Scan(&s.State, &s.CodeVerifier, &s.Nonce, &s.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return OIDCState{}, nil
+		}
+		return OIDCState{}, err
+	}
+
+	result, err := c.exec("DELETE FROM oidc_states WHERE state = ?", state)
+	if err != nil {
+		return OIDCState{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return OIDCState{}, err
+	}
+	// another request consumed it between the select and the delete
+	if n == 0 || !time.Now().Before(s.ExpiresAt) {
+		return OIDCState{}, nil
+	}
+	return s, nil
+}
+
+// GetUserByIdentity returns the user linked to the provider's subject, or nil
+// if none is.
+func (c Client) GetUserByIdentity(issuer, subject string) (*User, error) {
+	query := `
+		SELECT` + userColumns + `
+		FROM users
+		JOIN user_identities ui ON users.id = ui.user_id
+		WHERE ui.issuer = ? AND ui.subject = ?
+	`
+	user, err := scanUser(c.queryRow(query, issuer, subject))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LinkIdentity lets the user log in as the provider's subject from now on.
+func (c Client) LinkIdentity(userID uuid.UUID, issuer, subject, email string) error {
+	query := `
+	INSERT INTO user_identities (issuer, subject, user_id, email, created_at)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.exec(query, issuer, subject, userID.String(), email)
+	return err
+}
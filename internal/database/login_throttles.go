@@ -0,0 +1,77 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginThrottle tracks recent failed logins for one key, such as an email
+// address or an IP address.
+type LoginThrottle struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+// LockedFor returns how long logins for the key stay locked, or 0 if they aren't.
+func (t LoginThrottle) LockedFor(now time.Time) time.Duration {
+	if t.LockedUntil == nil || !now.Before(*t.LockedUntil) {
+		return 0
+	}
+	return t.LockedUntil.Sub(now)
+}
+
+// GetLoginThrottle returns the key's throttle, or a zero LoginThrottle if it
+// has no recent failures.
+func (c Client) GetLoginThrottle(key string) (LoginThrottle, error) {
+	query := `
+	SELECT throttle_key, failures, last_failed_at, locked_until
+	FROM login_throttles
+	WHERE throttle_key = ?
+	`
+	var t LoginThrottle
+	err := c.queryRow(query, key).Scan(&t.Key, &t.Failures, &t.LastFailedAt, &t.LockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LoginThrottle{}, nil
+		}
+		return LoginThrottle{}, err
+	}
+	return t, nil
+}
+
+// RecordLoginFailure counts a failed login for the key and returns the
+// updated throttle. Failures older than window are forgotten, so the count
+// starts over. The increment is atomic, so concurrent guesses are all counted.
+func (c Client) RecordLoginFailure(key string, window time.Duration) (LoginThrottle, error) {
+	now := time.Now()
+	query := `
+	INSERT INTO login_throttles (throttle_key, failures, last_failed_at)
+	VALUES (?, 1, ?)
+	ON CONFLICT (throttle_key) DO UPDATE SET
+		failures = CASE
+			WHEN login_throttles.last_failed_at > ? THEN login_throttles.failures + 1
+			ELSE 1
+		END,
+		last_failed_at = excluded.last_failed_at
+	`
+	_, err := c.exec(query, key, c.dialect.timeArg(now), c.dialect.timeArg(now.Add(-window)))
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	return c.GetLoginThrottle(key)
+}
+
+// LockLogin blocks logins for the key until the given time.
+func (c Client) LockLogin(key string, until time.Time) error {
+	_, err := c.exec("UPDATE login_throttles SET locked_until = ? WHERE throttle_key = ?", c.dialect.timeArg(until), key)
+	return err
+}
+
+// ClearLoginThrottle forgets the key's failures and lifts any lock.
+func (c Client) ClearLoginThrottle(key string) error {
+	_, err := c.exec("DELETE FROM login_throttles WHERE throttle_key = ?", key)
+	return err
+}
@@ -0,0 +1,295 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockID is an arbitrary key for the Postgres advisory lock that
+// stops two instances from migrating the same database at once.
+const migrationLockID = 7_410_392_025
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrationChecks run before the migration with the same version and stop it
+// when existing data needs a person to decide how it should be migrated.
+var migrationChecks = map[int]func(ctx context.Context, tx *sql.Tx) error{
+	18: checkEmailConflicts,
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// loadMigrations reads the embedded NNNN_name.up.sql / NNNN_name.down.sql
+// pairs for the dialect, ordered by version.
+func (d dialect) loadMigrations() ([]migration, error) {
+	dir := path.Join("migrations", string(d))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", fileName, err)
+		}
+
+		dat, err := fs.ReadFile(migrationFiles, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(dat)
+		} else {
+			m.Down = string(dat)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies every migration newer than the current schema version.
+func (c Client) MigrateUp() error {
+	return c.withMigrationLock(func(conn *sql.Conn) error {
+		migrations, err := c.dialect.loadMigrations()
+		if err != nil {
+			return err
+		}
+		applied, err := c.appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err = c.runMigration(conn, migrationChecks[m.Version], m.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, CURRENT_TIMESTAMP)",
+				m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %d (%s): %w", m.Version, m.Name, err)
+			}
+		}
+
+		if c.dialect == dialectSQLite {
+			err = c.syncSearchIndex(conn)
+			if err != nil {
+				return fmt.Errorf("failed to set up search index: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown rolls back the most recent steps applied migrations.
+func (c Client) MigrateDown(steps int) error {
+	return c.withMigrationLock(func(conn *sql.Conn) error {
+		migrations, err := c.dialect.loadMigrations()
+		if err != nil {
+			return err
+		}
+		applied, err := c.appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			err = c.runMigration(conn, nil, m.Down,
+				"DELETE FROM schema_migrations WHERE version = ?",
+				m.Version)
+			if err != nil {
+				return fmt.Errorf("failed to roll back migration %d (%s): %w", m.Version, m.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// MigrationStatus lists every known migration and when it was applied, if ever.
+func (c Client) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := c.dialect.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	applied, err := c.appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// withMigrationLock runs fn on a single connection, holding an advisory lock on Postgres.
+func (c Client) withMigrationLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if c.dialect == dialectPostgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}
+
+	return fn(conn)
+}
+
+func (c Client) appliedMigrations(conn *sql.Conn) (map[int]time.Time, error) {
+	ctx := context.Background()
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at %s NOT NULL
+	);
+	`, c.dialect.timestampType()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration executes check, if any, a migration script and its bookkeeping
+// statement in one transaction.
+func (c Client) runMigration(conn *sql.Conn, check func(ctx context.Context, tx *sql.Tx) error, script, bookkeeping string, args ...any) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if check != nil {
+		if err := check(ctx, tx); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, c.dialect.rebind(bookkeeping), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkEmailConflicts refuses to normalize emails while several accounts share
+// an address that only differs in case or surrounding spaces. Which of them
+// should keep it isn't something a migration can guess, so the conflicting
+// accounts are listed for an admin to merge or rename first.
+func checkEmailConflicts(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+	SELECT id, email FROM users
+	WHERE LOWER(TRIM(email)) IN (
+		SELECT LOWER(TRIM(email)) FROM users
+		GROUP BY LOWER(TRIM(email))
+		HAVING COUNT(*) > 1
+	)
+	ORDER BY LOWER(TRIM(email)), email
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	conflicts := []string{}
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return err
+		}
+		conflicts = append(conflicts, fmt.Sprintf("%s (%s)", email, id))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("emails of these users only differ in case or spacing; merge or rename them first: %s", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
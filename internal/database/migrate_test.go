@@ -0,0 +1,143 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	var versions [][]int
+	for _, d := range []dialect{dialectSQLite, dialectPostgres} {
+		migrations, err := d.loadMigrations()
+		if err != nil {
+			t.Fatalf("%s: %v", d, err)
+		}
+		var dialectVersions []int
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s: migration %d (%s) is numbered %d", d, i+1, m.Name, m.Version)
+			}
+			dialectVersions = append(dialectVersions, m.Version)
+		}
+		versions = append(versions, dialectVersions)
+	}
+	if len(versions[0]) != len(versions[1]) {
+		t.Errorf("sqlite has %d migrations, postgres has %d", len(versions[0]), len(versions[1]))
+	}
+}
+
+func appliedCount(t *testing.T, c Client) int {
+	t.Helper()
+	statuses, err := c.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := 0
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			applied++
+		}
+	}
+	return applied
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	c, err := NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	migrations, err := c.dialect.loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedCount(t, c); got != len(migrations) {
+		t.Fatalf("after MigrateUp: %d migrations applied, want %d", got, len(migrations))
+	}
+	// applying again is a no-op
+	err = c.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.MigrateDown(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedCount(t, c); got != len(migrations)-1 {
+		t.Fatalf("after MigrateDown(1): %d migrations applied, want %d", got, len(migrations)-1)
+	}
+
+	// every down migration must undo its up migration cleanly
+	err = c.MigrateDown(len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedCount(t, c); got != 0 {
+		t.Fatalf("after rolling back everything: %d migrations applied, want 0", got)
+	}
+	err = c.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedCount(t, c); got != len(migrations) {
+		t.Fatalf("after reapplying: %d migrations applied, want %d", got, len(migrations))
+	}
+}
+
+func TestNormalizeEmailsConflict(t *testing.T) {
+	c := newTestClient(t)
+	migrations, err := c.dialect.loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// roll back to just before the emails were normalized
+	err = c.MigrateDown(len(migrations) - 17)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"Dup@Example.com", " dup@example.com", "unique@Example.com"} {
+		_, err = c.exec("INSERT INTO users (id, email, password) VALUES (?, ?, ?)", uuid.NewString(), email, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = c.MigrateUp()
+	if err == nil {
+		t.Fatal("MigrateUp() succeeded with conflicting emails")
+	}
+	for _, email := range []string{"Dup@Example.com", " dup@example.com"} {
+		if !strings.Contains(err.Error(), email) {
+			t.Errorf("error %q doesn't list %q", err, email)
+		}
+	}
+	if strings.Contains(err.Error(), "unique@") {
+		t.Errorf("error %q lists an email without conflicts", err)
+	}
+
+	_, err = c.exec("DELETE FROM users WHERE email = ?", " dup@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp() after resolving the conflict: %v", err)
+	}
+	user, err := c.GetUserByEmail("dup@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "dup@example.com" {
+		t.Errorf("email = %q, want it normalized", user.Email)
+	}
+}
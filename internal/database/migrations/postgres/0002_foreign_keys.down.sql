@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_user_id;
+
+ALTER TABLE refresh_tokens
+	DROP CONSTRAINT refresh_tokens_user_id_fkey,
+	ADD CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+DROP INDEX IF EXISTS idx_videos_user_id;
+
+ALTER TABLE videos
+	DROP CONSTRAINT videos_user_id_fkey,
+	ADD CONSTRAINT videos_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE videos ALTER COLUMN user_id DROP NOT NULL;
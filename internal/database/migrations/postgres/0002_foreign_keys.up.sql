@@ -0,0 +1,14 @@
+DELETE FROM videos WHERE user_id IS NULL;
+ALTER TABLE videos ALTER COLUMN user_id SET NOT NULL;
+
+ALTER TABLE videos
+	DROP CONSTRAINT videos_user_id_fkey,
+	ADD CONSTRAINT videos_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_videos_user_id ON videos(user_id);
+
+ALTER TABLE refresh_tokens
+	DROP CONSTRAINT refresh_tokens_user_id_fkey,
+	ADD CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
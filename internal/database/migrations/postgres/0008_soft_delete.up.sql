@@ -0,0 +1,3 @@
+ALTER TABLE videos ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_videos_deleted_at ON videos(deleted_at);
@@ -0,0 +1,6 @@
+-- Tokens minted by rotating another token share its family, so replaying a
+-- rotated-away token can revoke every descendant at once.
+ALTER TABLE refresh_tokens ADD COLUMN family_id TEXT;
+UPDATE refresh_tokens SET family_id = token WHERE family_id IS NULL;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,4 @@
+-- A session is a refresh token family; each token records the client that
+-- last used it so users can tell their sessions apart.
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,22 @@
+-- External identities users log in with through OpenID Connect, keyed by the
+-- provider's issuer and subject.
+CREATE TABLE user_identities (
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(issuer, subject),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- Pending logins: each state is used once, by the callback it was created for.
+CREATE TABLE oidc_states (
+	state TEXT PRIMARY KEY,
+	code_verifier TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMPTZ NOT NULL
+);
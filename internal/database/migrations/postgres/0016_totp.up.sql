@@ -0,0 +1,16 @@
+-- totp_secret is set at enrollment; two-factor login is only required once
+-- totp_enabled_at shows the user confirmed it with a code. totp_last_step is
+-- the time step of the last accepted code, so codes can't be replayed.
+ALTER TABLE users ADD COLUMN totp_secret TEXT;
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT;
+
+CREATE TABLE recovery_codes (
+	code_hash TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	used_at TIMESTAMPTZ,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
@@ -0,0 +1,7 @@
+-- Recent failed logins per throttle_key, e.g. "email:<address>" or "ip:<address>".
+CREATE TABLE login_throttles (
+	throttle_key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	last_failed_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+-- This migration can't be reversed: the original case and spacing of the
+-- normalized emails isn't kept, so rolling back leaves them lowercased.
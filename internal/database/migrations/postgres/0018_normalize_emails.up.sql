@@ -0,0 +1,7 @@
+-- Emails are stored trimmed and lowercased so lookups and login throttling
+-- agree on which account an address belongs to. Before this runs,
+-- checkEmailConflicts fails the migration if that would give two accounts the
+-- same address.
+UPDATE users
+SET email = LOWER(TRIM(email))
+WHERE email <> LOWER(TRIM(email));
@@ -0,0 +1,4 @@
+-- Bytes stored for each video's file and thumbnail, counted against the
+-- owner's quota. Uploads from before this migration count as 0.
+ALTER TABLE videos ADD COLUMN video_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN thumbnail_size BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_videos_user_id_created_at;
+
+ALTER TABLE videos DROP COLUMN duration;
+ALTER TABLE videos DROP COLUMN aspect_ratio;
@@ -0,0 +1,4 @@
+ALTER TABLE videos ADD COLUMN aspect_ratio TEXT;
+ALTER TABLE videos ADD COLUMN duration REAL;
+
+CREATE INDEX idx_videos_user_id_created_at ON videos(user_id, created_at, id);
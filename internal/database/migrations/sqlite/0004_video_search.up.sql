@@ -0,0 +1,3 @@
+-- The videos_fts index needs SQLite built with FTS5 (go build -tags
+-- sqlite_fts5), so it isn't created here: syncSearchIndex sets it up after
+-- migrating when FTS5 is available, and search falls back to LIKE otherwise.
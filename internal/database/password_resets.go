@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidResetToken = errors.New("password reset token is invalid, expired or already used")
+
+type CreatePasswordResetTokenParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (c Client) CreatePasswordResetToken(params CreatePasswordResetTokenParams) error {
+	query := `
+	INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP, ?)
+	`
+	_, err := c.exec(query, params.TokenHash, params.UserID.String(), c.dialect.timeArg(params.ExpiresAt))
+	return err
+}
+
+// ResetPassword uses up the reset token, sets the user's password hash,
+// marks their email verified and logs them out everywhere by revoking their
+// refresh tokens, all in one transaction. It returns ErrInvalidResetToken if the token can't be used.
+func (c Client) ResetPassword(tokenHash, passwordHash string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(c.dialect.rebind(`
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+	`), tokenHash, c.dialect.timeArg(time.Now())).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	// the used_at check makes concurrent resets with the same token race safely:
+	// only one of them updates the row
+	result, err := tx.Exec(c.dialect.rebind(`
+		UPDATE password_reset_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = ? AND used_at IS NULL
+	`), tokenHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidResetToken
+	}
+
+	// any other outstanding links for the user stop working too
+	_, err = tx.Exec(c.dialect.rebind(`
+		UPDATE password_reset_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND used_at IS NULL
+	`), userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c.dialect.rebind(`
+		UPDATE users
+		SET
+			password = ?,
+			updated_at = CURRENT_TIMESTAMP,
+			-- the emailed token proves they own the address
+			email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+		WHERE id = ?
+	`), passwordHash, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c.dialect.rebind(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND revoked_at IS NULL
+	`), userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
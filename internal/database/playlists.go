@@ -0,0 +1,296 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const MaxPlaylistEntries = 500
+
+var (
+	ErrPlaylistEntryExists   = errors.New("video is already in the playlist")
+	ErrPlaylistEntryNotFound = errors.New("video is not in the playlist")
+	ErrPlaylistFull          = errors.New("playlist is full")
+	ErrPlaylistOrderMismatch = errors.New("new order must list every video in the playlist exactly once")
+)
+
+type Playlist struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatePlaylistParams
+}
+
+type CreatePlaylistParams struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	UserID      uuid.UUID `json:"user_id"`
+}
+
+type PlaylistEntry struct {
+	Position int `json:"position"`
+	Video
+}
+
+func (c Client) CreatePlaylist(params CreatePlaylistParams) (Playlist, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO playlists (
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		user_id
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	`
+	_, err := c.exec(query, id, params.Title, params.Description, params.UserID)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	return c.GetPlaylist(id)
+}
+
+func (c Client) GetPlaylist(id uuid.UUID) (Playlist, error) {
+	query := `
+	SELECT id, created_at, updated_at, title, description, user_id
+	FROM playlists
+	WHERE id = ?
+	`
+	var playlist Playlist
+	err := c.queryRow(query, id).Scan(
+		&playlist.ID,
+		&playlist.CreatedAt,
+		&playlist.UpdatedAt,
+		&playlist.Title,
+		&playlist.Description,
+		&playlist.UserID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Playlist{}, nil
+		}
+		return Playlist{}, err
+	}
+	return playlist, nil
+}
+
+func (c Client) GetPlaylists(userID uuid.UUID) ([]Playlist, error) {
+	query := `
+	SELECT id, created_at, updated_at, title, description, user_id
+	FROM playlists
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC
+	`
+	rows, err := c.query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		var playlist Playlist
+		if err := rows.Scan(
+			&playlist.ID,
+			&playlist.CreatedAt,
+			&playlist.UpdatedAt,
+			&playlist.Title,
+			&playlist.Description,
+			&playlist.UserID,
+		); err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, rows.Err()
+}
+
+func (c Client) UpdatePlaylist(playlist Playlist) error {
+	query := `
+	UPDATE playlists
+	SET title = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.exec(query, playlist.Title, playlist.Description, playlist.ID)
+	return err
+}
+
+func (c Client) DeletePlaylist(id uuid.UUID) error {
+	_, err := c.exec("DELETE FROM playlists WHERE id = ?", id)
+	return err
+}
+
+// GetPlaylistEntries returns the playlist's videos in playback order,
+// skipping any that are in the trash.
+func (c Client) GetPlaylistEntries(playlistID uuid.UUID) ([]PlaylistEntry, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	JOIN (
+		SELECT video_id, position FROM playlist_entries WHERE playlist_id = ?
+	) pe ON pe.video_id = videos.id
+	WHERE deleted_at IS NULL
+	ORDER BY pe.position ASC
+	`
+	videos, err := c.queryVideos(query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]PlaylistEntry, len(videos))
+	for i, video := range videos {
+		entries[i] = PlaylistEntry{Position: i, Video: video}
+	}
+	return entries, nil
+}
+
+// AddPlaylistEntry inserts a video at position, or at the end when position
+// is negative or past the end.
+func (c Client) AddPlaylistEntry(playlistID, videoID uuid.UUID, position int) error {
+	return c.updatePlaylistOrder(playlistID, func(order []uuid.UUID) ([]uuid.UUID, error) {
+		for _, id := range order {
+			if id == videoID {
+				return nil, ErrPlaylistEntryExists
+			}
+		}
+		if len(order) >= MaxPlaylistEntries {
+			return nil, ErrPlaylistFull
+		}
+		if position < 0 || position > len(order) {
+			position = len(order)
+		}
+		order = append(order, uuid.Nil)
+		copy(order[position+1:], order[position:])
+		order[position] = videoID
+		return order, nil
+	})
+}
+
+func (c Client) RemovePlaylistEntry(playlistID, videoID uuid.UUID) error {
+	return c.updatePlaylistOrder(playlistID, func(order []uuid.UUID) ([]uuid.UUID, error) {
+		for i, id := range order {
+			if id == videoID {
+				return append(order[:i], order[i+1:]...), nil
+			}
+		}
+		return nil, ErrPlaylistEntryNotFound
+	})
+}
+
+// ReorderPlaylistEntries sets the playback order; videoIDs must be a
+// permutation of the playlist's current videos.
+func (c Client) ReorderPlaylistEntries(playlistID uuid.UUID, videoIDs []uuid.UUID) error {
+	return c.updatePlaylistOrder(playlistID, func(order []uuid.UUID) ([]uuid.UUID, error) {
+		if len(order) != len(videoIDs) {
+			return nil, ErrPlaylistOrderMismatch
+		}
+		current := map[uuid.UUID]bool{}
+		for _, id := range order {
+			current[id] = true
+		}
+		for _, id := range videoIDs {
+			if !current[id] {
+				return nil, ErrPlaylistOrderMismatch
+			}
+			delete(current, id)
+		}
+		return videoIDs, nil
+	})
+}
+
+// updatePlaylistOrder loads the playlist's video order, lets change rewrite
+// it, and stores the result with positions renumbered 0..n-1, all in one transaction.
+func (c Client) updatePlaylistOrder(playlistID uuid.UUID, change func(order []uuid.UUID) ([]uuid.UUID, error)) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// touch the playlist first so concurrent edits of it serialize on Postgres
+	_, err = tx.Exec(c.dialect.rebind("UPDATE playlists SET updated_at = CURRENT_TIMESTAMP WHERE id = ?"), playlistID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(c.dialect.rebind(`
+	SELECT pe.video_id, v.deleted_at IS NOT NULL
+	FROM playlist_entries pe
+	JOIN videos v ON v.id = pe.video_id
+	WHERE pe.playlist_id = ?
+	ORDER BY pe.position ASC
+	`), playlistID)
+	if err != nil {
+		return err
+	}
+	order := []uuid.UUID{}
+	trashed := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		var isTrashed bool
+		if err := rows.Scan(&id, &isTrashed); err != nil {
+			rows.Close()
+			return err
+		}
+		if isTrashed {
+			trashed = append(trashed, id)
+		} else {
+			order = append(order, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	existing := map[uuid.UUID]bool{}
+	for _, id := range append(order, trashed...) {
+		existing[id] = true
+	}
+
+	// change only sees visible entries; trashed ones keep their place at the
+	// end so they reappear if restored
+	order, err = change(order)
+	if err != nil {
+		return err
+	}
+	order = append(order, trashed...)
+
+	kept := map[uuid.UUID]bool{}
+	for position, id := range order {
+		kept[id] = true
+		if existing[id] {
+			_, err = tx.Exec(c.dialect.rebind(`
+			UPDATE playlist_entries SET position = ?
+			WHERE playlist_id = ? AND video_id = ?
+			`), position, playlistID, id)
+		} else {
+			_, err = tx.Exec(c.dialect.rebind(`
+			INSERT INTO playlist_entries (playlist_id, video_id, position, created_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			`), playlistID, id, position)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for id := range existing {
+		if kept[id] {
+			continue
+		}
+		_, err = tx.Exec(c.dialect.rebind(`
+		DELETE FROM playlist_entries
+		WHERE playlist_id = ? AND video_id = ?
+		`), playlistID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
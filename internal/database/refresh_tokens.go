@@ -2,11 +2,16 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrRefreshTokenReused means a refresh token was presented after it had
+// already been rotated or revoked; its whole family has been revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
 type RefreshToken struct {
 	CreateRefreshTokenParams
 	CreatedAt time.Time  `json:"created_at"`
@@ -18,19 +23,102 @@ type CreateRefreshTokenParams struct {
 	Token     string    `json:"token"`
 	UserID    uuid.UUID `json:"user_id"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// FamilyID groups a login's token with every token rotated from it.
+	// Leave empty to start a new family.
+	FamilyID string `json:"family_id"`
+	// UserAgent and IPAddress identify the client the token was issued to.
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+}
+
+// Valid reports whether the token can still be exchanged for an access token.
+func (rt RefreshToken) Valid(now time.Time) bool {
+	return rt.Token != "" && rt.RevokedAt == nil && now.Before(rt.ExpiresAt)
 }
 
 func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+	err := c.insertRefreshToken(c.db, params)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	return c.GetRefreshToken(params.Token)
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (c Client) insertRefreshToken(db execer, params CreateRefreshTokenParams) error {
+	if params.FamilyID == "" {
+		params.FamilyID = uuid.NewString()
+	}
 	query := `
 		INSERT INTO refresh_tokens (
 			token,
 			created_at,
 			updated_at,
 			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+			expires_at,
+			family_id,
+			user_agent,
+			ip_address
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	_, err := db.Exec(
+		c.dialect.rebind(query),
+		params.Token,
+		params.UserID.String(),
+		c.dialect.timeArg(params.ExpiresAt),
+		params.FamilyID,
+		params.UserAgent,
+		params.IPAddress,
+	)
+	return err
+}
+
+// RotateRefreshToken revokes oldToken and issues params in the same family.
+// If oldToken was already revoked, e.g. by a concurrent refresh, the family
+// is revoked and ErrRefreshTokenReused returned.
+func (c Client) RotateRefreshToken(oldToken string, params CreateRefreshTokenParams) (RefreshToken, error) {
+	old, err := c.GetRefreshToken(oldToken)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	params.FamilyID = old.FamilyID
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(c.dialect.rebind(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE token = ? AND revoked_at IS NULL
+	`), oldToken)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if n == 0 {
+		tx.Rollback()
+		err = c.RevokeRefreshTokenFamily(old.FamilyID)
+		if err != nil {
+			return RefreshToken{}, err
+		}
+		return RefreshToken{}, ErrRefreshTokenReused
+	}
+
+	err = c.insertRefreshToken(tx, params)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	err = tx.Commit()
 	if err != nil {
 		return RefreshToken{}, err
 	}
@@ -41,23 +129,43 @@ func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToke
 func (c Client) RevokeRefreshToken(token string) error {
 	query := `
 		UPDATE refresh_tokens
-		SET revoked_at = CURRENT_TIMESTAMP
-		WHERE token = ?
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE token = ? AND revoked_at IS NULL
+	`
+	_, err := c.exec(query, token)
+	return err
+}
+
+// RevokeRefreshTokenFamily revokes every still-active token in the family.
+func (c Client) RevokeRefreshTokenFamily(familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE family_id = ? AND revoked_at IS NULL
 	`
-	_, err := c.db.Exec(query, token)
+	_, err := c.exec(query, familyID)
 	return err
 }
 
 func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip_address
 		FROM refresh_tokens
 		WHERE token = ?
 	`
 	var rt RefreshToken
 	var userID string
-	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
+	err := c.queryRow(query, token).Scan(
+		&rt.Token,
+		&rt.CreatedAt,
+		&rt.UpdatedAt,
+		&userID,
+		&rt.ExpiresAt,
+		&rt.RevokedAt,
+		&rt.FamilyID,
+		&rt.UserAgent,
+		&rt.IPAddress,
+	)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return RefreshToken{}, nil
@@ -78,6 +186,6 @@ func (c Client) DeleteRefreshToken(token string) error {
 		DELETE FROM refresh_tokens
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
+	_, err := c.exec(query, token)
 	return err
 }
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// syncSearchIndex keeps SQLite's videos_fts full-text index in step with
+// whether this build has FTS5. With FTS5 it creates the index and the
+// triggers that maintain it, rebuilding it if they were missing. Without, it
+// drops the triggers, which would otherwise break every write to videos, and
+// SearchVideos falls back to LIKE.
+func (c Client) syncSearchIndex(conn *sql.Conn) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !c.fts5 {
+		_, err = tx.ExecContext(ctx, `
+		DROP TRIGGER IF EXISTS videos_fts_insert;
+		DROP TRIGGER IF EXISTS videos_fts_update;
+		DROP TRIGGER IF EXISTS videos_fts_delete;
+		`)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	var triggers int
+	err = tx.QueryRowContext(ctx, `
+	SELECT COUNT(*) FROM sqlite_master
+	WHERE type = 'trigger' AND name IN ('videos_fts_insert', 'videos_fts_update', 'videos_fts_delete')
+	`).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+	if triggers == 3 {
+		return nil
+	}
+
+	// the index is new, or went stale while a build without FTS5 ran
+	_, err = tx.ExecContext(ctx, `
+	CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(
+		video_id UNINDEXED,
+		title,
+		description,
+		tokenize = 'porter unicode61'
+	);
+
+	DELETE FROM videos_fts;
+	INSERT INTO videos_fts (video_id, title, description)
+	SELECT id, title, COALESCE(description, '') FROM videos;
+
+	DROP TRIGGER IF EXISTS videos_fts_insert;
+	DROP TRIGGER IF EXISTS videos_fts_update;
+	DROP TRIGGER IF EXISTS videos_fts_delete;
+
+	CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+		INSERT INTO videos_fts (video_id, title, description)
+		VALUES (new.id, new.title, COALESCE(new.description, ''));
+	END;
+
+	CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos BEGIN
+		UPDATE videos_fts
+		SET title = new.title, description = COALESCE(new.description, '')
+		WHERE video_id = old.id;
+	END;
+
+	CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos BEGIN
+		DELETE FROM videos_fts WHERE video_id = old.id;
+	END;
+	`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is one login: the family of refresh tokens rotated from it. Only
+// families with a live token are sessions.
+type Session struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+// GetSessions lists a user's active sessions, most recently used first.
+func (c Client) GetSessions(userID uuid.UUID) ([]Session, error) {
+	query := `
+	SELECT family_id, created_at, expires_at, revoked_at, user_agent, ip_address
+	FROM refresh_tokens
+	WHERE user_id = ? AND family_id IN (
+		SELECT family_id FROM refresh_tokens
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+	)
+	ORDER BY created_at ASC
+	`
+	rows, err := c.query(query, userID, userID, c.dialect.timeArg(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[string]*Session{}
+	for rows.Next() {
+		var familyID, userAgent, ipAddress string
+		var createdAt, expiresAt time.Time
+		var revokedAt *time.Time
+		if err := rows.Scan(&familyID, &createdAt, &expiresAt, &revokedAt, &userAgent, &ipAddress); err != nil {
+			return nil, err
+		}
+
+		session, ok := byID[familyID]
+		if !ok {
+			// the family's oldest token marks when the user logged in
+			session = &Session{ID: familyID, CreatedAt: createdAt}
+			byID[familyID] = session
+		}
+		if revokedAt == nil {
+			// each refresh rotates the token, so the live one was issued at last use
+			session.LastUsedAt = createdAt
+			session.ExpiresAt = expiresAt
+			session.UserAgent = userAgent
+			session.IPAddress = ipAddress
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(byID))
+	for _, session := range byID {
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions, returning ErrSessionNotFound
+// if it doesn't belong to them or has already ended.
+func (c Client) RevokeSession(userID uuid.UUID, sessionID string) error {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL
+	`
+	result, err := c.exec(query, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAllSessions revokes every refresh token the user holds. Access tokens
+// already issued stay valid until they expire.
+func (c Client) RevokeAllSessions(userID uuid.UUID) error {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND revoked_at IS NULL
+	`
+	_, err := c.exec(query, userID)
+	return err
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store is the persistence API the handlers depend on. Client implements it
+// for every supported backend.
+type Store interface {
+	Reset() error
+	Close() error
+
+	MigrateUp() error
+	MigrateDown(steps int) error
+	MigrationStatus() ([]MigrationStatus, error)
+
+	GetUsers() ([]User, error)
+	GetUserByEmail(email string) (User, error)
+	GetUserByRefreshToken(token string) (*User, error)
+	CreateUser(params CreateUserParams) (*User, error)
+	GetUser(id uuid.UUID) (*User, error)
+	SetUserRole(id uuid.UUID, role Role) error
+	DisableUser(id uuid.UUID) error
+	EnableUser(id uuid.UUID) error
+	MarkEmailVerified(id uuid.UUID) error
+	SetTOTPSecret(userID uuid.UUID, secret string) error
+	EnableTOTP(userID uuid.UUID, step int64, recoveryCodeHashes []string) error
+	DisableTOTP(userID uuid.UUID) error
+	UseTOTPStep(userID uuid.UUID, step int64) error
+	UseRecoveryCode(userID uuid.UUID, codeHash string) error
+	DeleteUser(id uuid.UUID) error
+
+	CreateOIDCState(state OIDCState) error
+	ConsumeOIDCState(state string) (OIDCState, error)
+	GetUserByIdentity(issuer, subject string) (*User, error)
+	LinkIdentity(userID uuid.UUID, issuer, subject, email string) error
+
+	CreatePasswordResetToken(params CreatePasswordResetTokenParams) error
+	ResetPassword(tokenHash, passwordHash string) error
+
+	CreateEmailVerificationToken(params CreateEmailVerificationTokenParams) error
+	VerifyEmail(tokenHash string) error
+
+	GetLoginThrottle(key string) (LoginThrottle, error)
+	RecordLoginFailure(key string, window time.Duration) (LoginThrottle, error)
+	LockLogin(key string, until time.Time) error
+	ClearLoginThrottle(key string) error
+
+	CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error)
+	RevokeRefreshToken(token string) error
+	RevokeRefreshTokenFamily(familyID string) error
+	RotateRefreshToken(oldToken string, params CreateRefreshTokenParams) (RefreshToken, error)
+	GetRefreshToken(token string) (RefreshToken, error)
+	DeleteRefreshToken(token string) error
+
+	GetSessions(userID uuid.UUID) ([]Session, error)
+	RevokeSession(userID uuid.UUID, sessionID string) error
+	RevokeAllSessions(userID uuid.UUID) error
+
+	CreateAPIKey(params CreateAPIKeyParams) (APIKey, error)
+	GetAPIKeys(userID uuid.UUID) ([]APIKey, error)
+	GetAPIKeyByHash(keyHash string) (APIKey, error)
+	TouchAPIKey(id uuid.UUID) error
+	DeleteAPIKey(userID, id uuid.UUID) error
+
+	GetVideos(params GetVideosParams) (VideoPage, error)
+	SearchVideos(params SearchVideosParams) ([]VideoSearchResult, error)
+	CreateVideo(params CreateVideoParams) (Video, error)
+	GetVideo(id uuid.UUID) (Video, error)
+	UpdateVideoIfVersion(video Video) (Video, error)
+	DeleteVideo(id uuid.UUID) error
+	TrashVideo(id uuid.UUID) error
+	RestoreVideo(id uuid.UUID) error
+	GetTrashedVideo(id uuid.UUID) (Video, error)
+	GetTrashedVideos(userID uuid.UUID) ([]Video, error)
+	GetExpiredTrash(cutoff time.Time, limit, offset int) ([]Video, error)
+	GetStorageUsage(userID uuid.UUID) (StorageUsage, error)
+	SetVideoFile(params SetVideoFileParams, limits StorageLimits) (*string, error)
+	SetThumbnailFile(videoID uuid.UUID, url string, size int64, limits StorageLimits) (*string, error)
+
+	AddVideoTags(video Video, tags []string) error
+	RemoveVideoTag(video Video, tag string) error
+	GetTags(userID uuid.UUID) ([]TagCount, error)
+
+	CreatePlaylist(params CreatePlaylistParams) (Playlist, error)
+	GetPlaylist(id uuid.UUID) (Playlist, error)
+	GetPlaylists(userID uuid.UUID) ([]Playlist, error)
+	UpdatePlaylist(playlist Playlist) error
+	DeletePlaylist(id uuid.UUID) error
+	GetPlaylistEntries(playlistID uuid.UUID) ([]PlaylistEntry, error)
+	AddPlaylistEntry(playlistID, videoID uuid.UUID, position int) error
+	RemovePlaylistEntry(playlistID, videoID uuid.UUID) error
+	ReorderPlaylistEntries(playlistID uuid.UUID, videoIDs []uuid.UUID) error
+}
+
+var _ Store = Client{}
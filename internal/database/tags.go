@@ -0,0 +1,218 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxTagLength    = 50
+	MaxTagsPerVideo = 20
+)
+
+var (
+	ErrInvalidTag  = errors.New("invalid tag")
+	ErrTooManyTags = fmt.Errorf("a video can have at most %d tags", MaxTagsPerVideo)
+)
+
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTag case-folds a tag, trims it and collapses inner whitespace so
+// "  Go  Tutorials" and "go tutorials" are the same tag.
+func NormalizeTag(tag string) (string, error) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+	if normalized == "" {
+		return "", fmt.Errorf("%w: tag can't be empty", ErrInvalidTag)
+	}
+	if utf8.RuneCountInString(normalized) > MaxTagLength {
+		return "", fmt.Errorf("%w: tags must be at most %d characters", ErrInvalidTag, MaxTagLength)
+	}
+	return normalized, nil
+}
+
+// AddVideoTags attaches tags to a video, creating them for the video's owner as
+// needed. Tags already on the video are left alone.
+func (c Client) AddVideoTags(video Video, tags []string) error {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		name, err := NormalizeTag(tag)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	existing, err := c.getVideoTags(video.ID)
+	if err != nil {
+		return err
+	}
+	total := map[string]bool{}
+	for _, name := range append(existing, names...) {
+		total[name] = true
+	}
+	if len(total) > MaxTagsPerVideo {
+		return ErrTooManyTags
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range names {
+		_, err = tx.Exec(c.dialect.rebind(`
+		INSERT INTO tags (id, created_at, user_id, name)
+		VALUES (?, CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT (user_id, name) DO NOTHING
+		`), uuid.New(), video.UserID, name)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(c.dialect.rebind(`
+		INSERT INTO video_tags (video_id, tag_id, created_at)
+		SELECT ?, id, CURRENT_TIMESTAMP
+		FROM tags
+		WHERE user_id = ? AND name = ?
+		ON CONFLICT (video_id, tag_id) DO NOTHING
+		`), video.ID, video.UserID, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveVideoTag detaches a tag from a video and drops the tag once no video uses it.
+func (c Client) RemoveVideoTag(video Video, tag string) error {
+	name, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(c.dialect.rebind(`
+	DELETE FROM video_tags
+	WHERE video_id = ? AND tag_id IN (SELECT id FROM tags WHERE user_id = ? AND name = ?)
+	`), video.ID, video.UserID, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c.dialect.rebind(`
+	DELETE FROM tags
+	WHERE user_id = ? AND name = ?
+		AND NOT EXISTS (SELECT 1 FROM video_tags WHERE video_tags.tag_id = tags.id)
+	`), video.UserID, name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTags lists a user's tags with how many of their videos carry each one.
+func (c Client) GetTags(userID uuid.UUID) ([]TagCount, error) {
+	query := `
+	SELECT t.name, COUNT(vt.video_id)
+	FROM tags t
+	JOIN video_tags vt ON vt.tag_id = t.id
+	JOIN videos v ON v.id = vt.video_id
+	WHERE t.user_id = ? AND v.deleted_at IS NULL
+	GROUP BY t.name
+	ORDER BY COUNT(vt.video_id) DESC, t.name ASC
+	`
+	rows, err := c.query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (c Client) getVideoTags(videoID uuid.UUID) ([]string, error) {
+	tagsByVideo, err := c.getTagsForVideos([]uuid.UUID{videoID})
+	if err != nil {
+		return nil, err
+	}
+	return tagsByVideo[videoID], nil
+}
+
+func (c Client) getTagsForVideos(videoIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	tagsByVideo := map[uuid.UUID][]string{}
+	if len(videoIDs) == 0 {
+		return tagsByVideo, nil
+	}
+
+	placeholders := make([]string, len(videoIDs))
+	args := make([]any, len(videoIDs))
+	for i, id := range videoIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := `
+	SELECT vt.video_id, t.name
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id IN (` + strings.Join(placeholders, ", ") + `)
+	ORDER BY t.name
+	`
+	rows, err := c.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var videoID uuid.UUID
+		var name string
+		if err := rows.Scan(&videoID, &name); err != nil {
+			return nil, err
+		}
+		tagsByVideo[videoID] = append(tagsByVideo[videoID], name)
+	}
+	return tagsByVideo, rows.Err()
+}
+
+// attachTags fills in Tags for each video with a single query.
+func (c Client) attachTags(videos []Video) error {
+	ids := make([]uuid.UUID, len(videos))
+	for i, video := range videos {
+		ids[i] = video.ID
+	}
+	tagsByVideo, err := c.getTagsForVideos(ids)
+	if err != nil {
+		return err
+	}
+	for i := range videos {
+		videos[i].Tags = tagsByVideo[videos[i].ID]
+		if videos[i].Tags == nil {
+			videos[i].Tags = []string{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{name: "already normal", tag: "go", want: "go"},
+		{name: "case folded", tag: "GoLang", want: "golang"},
+		{name: "trimmed", tag: "  go  ", want: "go"},
+		{name: "inner whitespace collapsed", tag: "  Go \t\n Tutorials", want: "go tutorials"},
+		{name: "unicode", tag: "Ünïcode Tág", want: "ünïcode tág"},
+		{name: "empty", tag: "", wantErr: true},
+		{name: "only whitespace", tag: " \t ", wantErr: true},
+		{name: "longest allowed", tag: strings.Repeat("é", MaxTagLength), want: strings.Repeat("é", MaxTagLength)},
+		{name: "too long", tag: strings.Repeat("a", MaxTagLength+1), wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeTag(tc.tag)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidTag) {
+					t.Errorf("NormalizeTag(%q) error = %v, want %v", tc.tag, err, ErrInvalidTag)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("NormalizeTag(%q) = %q, %v, want %q", tc.tag, got, err, tc.want)
+			}
+		})
+	}
+}
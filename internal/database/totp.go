@@ -0,0 +1,146 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTOTPCodeUsed        = errors.New("TOTP code was already used")
+	ErrInvalidRecoveryCode = errors.New("recovery code is invalid or already used")
+)
+
+// SetTOTPSecret starts two-factor enrollment, replacing any unconfirmed
+// secret. It returns ErrTOTPAlreadyEnabled once enrollment is confirmed.
+func (c Client) SetTOTPSecret(userID uuid.UUID, secret string) error {
+	query := `
+		UPDATE users
+		SET totp_secret = ?, totp_last_step = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND totp_enabled_at IS NULL
+	`
+	result, err := c.exec(query, secret, userID.String())
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP confirms enrollment with the time step of the code the user
+// entered, replacing their recovery codes with recoveryCodeHashes.
+func (c Client) EnableTOTP(userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(c.dialect.rebind(`
+		UPDATE users
+		SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND totp_enabled_at IS NULL AND totp_secret IS NOT NULL
+	`), step, userID.String())
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	_, err = tx.Exec(c.dialect.rebind("DELETE FROM recovery_codes WHERE user_id = ?"), userID.String())
+	if err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec(c.dialect.rebind(`
+			INSERT INTO recovery_codes (code_hash, user_id, created_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+		`), hash, userID.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns two-factor authentication off and deletes the secret and
+// recovery codes.
+func (c Client) DisableTOTP(userID uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(c.dialect.rebind(`
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`), userID.String())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(c.dialect.rebind("DELETE FROM recovery_codes WHERE user_id = ?"), userID.String())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code from the given time step was accepted,
+// returning ErrTOTPCodeUsed if one from the same or a later step already was.
+func (c Client) UseTOTPStep(userID uuid.UUID, step int64) error {
+	query := `
+		UPDATE users
+		SET totp_last_step = ?
+		WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)
+	`
+	result, err := c.exec(query, step, userID.String(), step)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+// UseRecoveryCode spends one of the user's recovery codes, returning
+// ErrInvalidRecoveryCode if it isn't theirs or was already used.
+func (c Client) UseRecoveryCode(userID uuid.UUID, codeHash string) error {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE code_hash = ? AND user_id = ? AND used_at IS NULL
+	`
+	result, err := c.exec(query, codeHash, userID.String())
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidRecoveryCode
+	}
+	return nil
+}
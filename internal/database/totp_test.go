@@ -0,0 +1,32 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUseTOTPStep(t *testing.T) {
+	c := newTestClient(t)
+	user, err := c.CreateUser(CreateUserParams{Email: "user@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		step    int64
+		wantErr error
+	}{
+		{name: "first code", step: 100},
+		{name: "same code replayed", step: 100, wantErr: ErrTOTPCodeUsed},
+		{name: "next code", step: 101},
+		{name: "earlier code", step: 100, wantErr: ErrTOTPCodeUsed},
+		{name: "later code", step: 103},
+	}
+	for _, step := range steps {
+		err := c.UseTOTPStep(user.ID, step.step)
+		if !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: UseTOTPStep(%d) error = %v, want %v", step.name, step.step, err, step.wantErr)
+		}
+	}
+}
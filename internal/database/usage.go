@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+	ErrVideoLimitReached    = errors.New("video limit reached")
+)
+
+// StorageUsage is what a user has stored, including videos in the trash
+// since they still take up space until they are purged.
+type StorageUsage struct {
+	VideoBytes     int64 `json:"video_bytes"`
+	ThumbnailBytes int64 `json:"thumbnail_bytes"`
+	// VideoCount only counts videos with an uploaded video file.
+	VideoCount int `json:"video_count"`
+}
+
+func (u StorageUsage) TotalBytes() int64 {
+	return u.VideoBytes + u.ThumbnailBytes
+}
+
+// StorageLimits bound what each user can store. Zero means unlimited.
+type StorageLimits struct {
+	MaxBytes  int64
+	MaxVideos int
+}
+
+func (c Client) GetStorageUsage(userID uuid.UUID) (StorageUsage, error) {
+	var usage StorageUsage
+	err := c.queryRow(storageUsageQuery, userID).Scan(&usage.VideoBytes, &usage.ThumbnailBytes, &usage.VideoCount)
+	return usage, err
+}
+
+const storageUsageQuery = `
+	SELECT
+		COALESCE(SUM(video_size), 0),
+		COALESCE(SUM(thumbnail_size), 0),
+		COUNT(video_url)
+	FROM videos
+	WHERE user_id = ?
+	`
+
+type SetVideoFileParams struct {
+	VideoID     uuid.UUID
+	URL         string
+	Size        int64
+	AspectRatio *string
+	Duration    *float64
+}
+
+// SetVideoFile stores the uploaded video file, returning the URL of the file
+// it replaces, if any. It returns ErrStorageQuotaExceeded or
+// ErrVideoLimitReached, changing nothing, if the owner has no room for it.
+func (c Client) SetVideoFile(params SetVideoFileParams, limits StorageLimits) (*string, error) {
+	return c.replaceFile(params.VideoID, "video_url", "video_size", params.Size, limits, `
+		UPDATE videos
+		SET
+			video_url = ?,
+			video_size = ?,
+			aspect_ratio = ?,
+			duration = ?,
+			updated_at = CURRENT_TIMESTAMP,
+			version = version + 1
+		WHERE id = ?
+		`, params.URL, params.Size, params.AspectRatio, params.Duration, params.VideoID)
+}
+
+// SetThumbnailFile stores the uploaded thumbnail like SetVideoFile.
+func (c Client) SetThumbnailFile(videoID uuid.UUID, url string, size int64, limits StorageLimits) (*string, error) {
+	return c.replaceFile(videoID, "thumbnail_url", "thumbnail_size", size, limits, `
+		UPDATE videos
+		SET
+			thumbnail_url = ?,
+			thumbnail_size = ?,
+			updated_at = CURRENT_TIMESTAMP,
+			version = version + 1
+		WHERE id = ?
+		`, url, size, videoID)
+}
+
+// replaceFile runs update if the video's owner has room for a file of size
+// bytes in place of the one in urlColumn and sizeColumn, returning the
+// replaced URL. Uploads for the same user are serialized so concurrent ones
+// can't both fit into the same remaining space.
+func (c Client) replaceFile(videoID uuid.UUID, urlColumn, sizeColumn string, size int64, limits StorageLimits, update string, args ...any) (*string, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// writing first locks the owner's row in Postgres, and the whole database
+	// in SQLite, until the transaction ends
+	_, err = tx.Exec(c.dialect.rebind(`
+		UPDATE users SET updated_at = updated_at
+		WHERE id = (SELECT user_id FROM videos WHERE id = ?)
+	`), videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	var userID string
+	var replacedURL *string
+	var replacedSize int64
+	err = tx.QueryRow(c.dialect.rebind(fmt.Sprintf(
+		"SELECT user_id, %s, %s FROM videos WHERE id = ?", urlColumn, sizeColumn,
+	)), videoID).Scan(&userID, &replacedURL, &replacedSize)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("video %s not found", videoID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var usage StorageUsage
+	err = tx.QueryRow(c.dialect.rebind(storageUsageQuery), userID).Scan(&usage.VideoBytes, &usage.ThumbnailBytes, &usage.VideoCount)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && usage.TotalBytes()-replacedSize+size > limits.MaxBytes {
+		return nil, ErrStorageQuotaExceeded
+	}
+	if urlColumn == "video_url" && replacedURL == nil && limits.MaxVideos > 0 && usage.VideoCount >= limits.MaxVideos {
+		return nil, ErrVideoLimitReached
+	}
+
+	_, err = tx.Exec(c.dialect.rebind(update), args...)
+	if err != nil {
+		return nil, err
+	}
+	return replacedURL, tx.Commit()
+}
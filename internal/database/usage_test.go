@@ -0,0 +1,145 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func newTestVideo(t *testing.T, c Client, email string) Video {
+	t.Helper()
+	user, err := c.CreateUser(CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := c.CreateVideo(CreateVideoParams{Title: "video", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
+
+func TestSetVideoFileQuota(t *testing.T) {
+	c := newTestClient(t)
+	video := newTestVideo(t, c, "user@example.com")
+	limits := StorageLimits{MaxBytes: 1000, MaxVideos: 1}
+
+	replaced, err := c.SetVideoFile(SetVideoFileParams{VideoID: video.ID, URL: "first", Size: 600}, limits)
+	if err != nil || replaced != nil {
+		t.Fatalf("first upload: replaced %v, error %v", replaced, err)
+	}
+	// the old file's size is freed by replacing it
+	replaced, err = c.SetVideoFile(SetVideoFileParams{VideoID: video.ID, URL: "second", Size: 900}, limits)
+	if err != nil || replaced == nil || *replaced != "first" {
+		t.Fatalf("replacing upload: replaced %v, error %v", replaced, err)
+	}
+	_, err = c.SetThumbnailFile(video.ID, "thumbnail", 200, limits)
+	if !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Fatalf("thumbnail over quota: got error %v, want %v", err, ErrStorageQuotaExceeded)
+	}
+
+	other, err := c.CreateVideo(CreateVideoParams{Title: "other", UserID: video.UserID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SetVideoFile(SetVideoFileParams{VideoID: other.ID, URL: "third", Size: 1}, limits)
+	if !errors.Is(err, ErrVideoLimitReached) {
+		t.Fatalf("second video: got error %v, want %v", err, ErrVideoLimitReached)
+	}
+
+	stored, err := c.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.VideoURL == nil || *stored.VideoURL != "second" || stored.VideoSize != 900 || stored.ThumbnailURL != nil {
+		t.Errorf("unexpected stored video %+v", stored)
+	}
+}
+
+func TestSetThumbnailFileConcurrent(t *testing.T) {
+	c := newTestClient(t)
+	limits := StorageLimits{MaxBytes: 1000}
+	first := newTestVideo(t, c, "user@example.com")
+
+	var videos []Video
+	for range 4 {
+		video, err := c.CreateVideo(CreateVideoParams{Title: "video", UserID: first.UserID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		videos = append(videos, video)
+	}
+
+	// each upload fits on its own, but only two fit together
+	var wg sync.WaitGroup
+	errs := make([]error, len(videos))
+	for i, video := range videos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = c.SetThumbnailFile(video.ID, "thumbnail", 400, limits)
+		}()
+	}
+	wg.Wait()
+
+	stored := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			stored++
+		case !errors.Is(err, ErrStorageQuotaExceeded):
+			t.Fatal(err)
+		}
+	}
+	usage, err := c.GetStorageUsage(first.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != 2 || usage.TotalBytes() != 800 {
+		t.Errorf("stored %d thumbnails using %d bytes, want 2 using 800", stored, usage.TotalBytes())
+	}
+}
+
+func TestSetVideoFileConcurrent(t *testing.T) {
+	c := newTestClient(t)
+	limits := StorageLimits{MaxBytes: 1000, MaxVideos: 2}
+	first := newTestVideo(t, c, "user@example.com")
+
+	var videos []Video
+	for range 4 {
+		video, err := c.CreateVideo(CreateVideoParams{Title: "video", UserID: first.UserID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		videos = append(videos, video)
+	}
+
+	// every upload fits the byte quota, but only two videos are allowed
+	var wg sync.WaitGroup
+	errs := make([]error, len(videos))
+	for i, video := range videos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = c.SetVideoFile(SetVideoFileParams{VideoID: video.ID, URL: "video", Size: 100}, limits)
+		}()
+	}
+	wg.Wait()
+
+	stored := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			stored++
+		case !errors.Is(err, ErrVideoLimitReached):
+			t.Fatal(err)
+		}
+	}
+	usage, err := c.GetStorageUsage(first.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != 2 || usage.VideoCount != 2 || usage.VideoBytes != 200 {
+		t.Errorf("stored %d videos, usage %+v, want 2 videos using 200 bytes", stored, usage)
+	}
+}
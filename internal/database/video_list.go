@@ -0,0 +1,216 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoSort string
+
+const (
+	VideoSortNewest   VideoSort = "newest"
+	VideoSortOldest   VideoSort = "oldest"
+	VideoSortTitle    VideoSort = "title"
+	VideoSortDuration VideoSort = "duration" // longest first, drafts without a video last
+)
+
+const (
+	DefaultVideoPageSize = 20
+	MaxVideoPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type GetVideosParams struct {
+	UserID        uuid.UUID
+	Sort          VideoSort
+	Limit         int
+	Cursor        string
+	HasVideo      *bool
+	HasThumbnail  *bool
+	AspectRatio   string
+	Tags          []string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+type VideoPage struct {
+	Videos     []Video `json:"videos"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// videoSortSpec is the keyset used for a sort order; id always breaks ties.
+type videoSortSpec struct {
+	key  string
+	desc bool
+}
+
+var videoSorts = map[VideoSort]videoSortSpec{
+	VideoSortNewest:   {key: "created_at", desc: true},
+	VideoSortOldest:   {key: "created_at", desc: false},
+	VideoSortTitle:    {key: "title", desc: false},
+	VideoSortDuration: {key: "COALESCE(duration, 0)", desc: true},
+}
+
+func (s VideoSort) Valid() bool {
+	_, ok := videoSorts[s]
+	return ok
+}
+
+// videoCursor is the position of the last video on a page. It is handed to
+// clients as opaque base64 and only the field matching Sort is set.
+type videoCursor struct {
+	Sort      VideoSort  `json:"s"`
+	CreatedAt *time.Time `json:"c,omitempty"`
+	Title     string     `json:"t,omitempty"`
+	Duration  float64    `json:"d,omitempty"`
+	ID        uuid.UUID  `json:"id"`
+}
+
+func newVideoCursor(sort VideoSort, video Video) videoCursor {
+	cursor := videoCursor{Sort: sort, ID: video.ID}
+	switch sort {
+	case VideoSortNewest, VideoSortOldest:
+		cursor.CreatedAt = &video.CreatedAt
+	case VideoSortTitle:
+		cursor.Title = video.Title
+	case VideoSortDuration:
+		if video.Duration != nil {
+			cursor.Duration = *video.Duration
+		}
+	}
+	return cursor
+}
+
+func (vc videoCursor) encode() string {
+	dat, _ := json.Marshal(vc)
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+func decodeVideoCursor(s string, sort VideoSort) (videoCursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	var cursor videoCursor
+	if err := json.Unmarshal(dat, &cursor); err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	if cursor.Sort != sort || cursor.ID == uuid.Nil {
+		return videoCursor{}, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidCursor)
+	}
+	if (sort == VideoSortNewest || sort == VideoSortOldest) && cursor.CreatedAt == nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func (c Client) cursorKey(cursor videoCursor) any {
+	switch cursor.Sort {
+	case VideoSortTitle:
+		return cursor.Title
+	case VideoSortDuration:
+		return cursor.Duration
+	default:
+		return c.dialect.timeArg(*cursor.CreatedAt)
+	}
+}
+
+// GetVideos returns one page of a user's videos using keyset pagination, so
+// pages stay stable while videos are added.
+func (c Client) GetVideos(params GetVideosParams) (VideoPage, error) {
+	if params.Sort == "" {
+		params.Sort = VideoSortNewest
+	}
+	spec, ok := videoSorts[params.Sort]
+	if !ok {
+		return VideoPage{}, fmt.Errorf("unknown sort order %q", params.Sort)
+	}
+	if params.Limit <= 0 {
+		params.Limit = DefaultVideoPageSize
+	}
+	if params.Limit > MaxVideoPageSize {
+		params.Limit = MaxVideoPageSize
+	}
+
+	conditions := []string{"user_id = ?", "deleted_at IS NULL"}
+	args := []any{params.UserID}
+
+	if params.HasVideo != nil {
+		conditions = append(conditions, nullCondition("video_url", *params.HasVideo))
+	}
+	if params.HasThumbnail != nil {
+		conditions = append(conditions, nullCondition("thumbnail_url", *params.HasThumbnail))
+	}
+	if params.AspectRatio != "" {
+		conditions = append(conditions, "aspect_ratio = ?")
+		args = append(args, params.AspectRatio)
+	}
+	for _, tag := range params.Tags {
+		name, err := NormalizeTag(tag)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		conditions = append(conditions, `id IN (
+		SELECT vt.video_id FROM video_tags vt JOIN tags t ON t.id = vt.tag_id WHERE t.name = ?
+	)`)
+		args = append(args, name)
+	}
+	if params.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, c.dialect.timeArg(*params.CreatedAfter))
+	}
+	if params.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, c.dialect.timeArg(*params.CreatedBefore))
+	}
+
+	direction, comparison := "ASC", ">"
+	if spec.desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if params.Cursor != "" {
+		cursor, err := decodeVideoCursor(params.Cursor, params.Sort)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (?, ?)", spec.key, comparison))
+		args = append(args, c.cursorKey(cursor), cursor.ID)
+	}
+
+	// fetch one extra row to learn whether another page exists
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY ` + spec.key + ` ` + direction + `, id ` + direction + `
+	LIMIT ?
+	`
+	args = append(args, params.Limit+1)
+
+	videos, err := c.queryVideos(query, args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+
+	page := VideoPage{Videos: videos}
+	if len(videos) > params.Limit {
+		page.Videos = videos[:params.Limit]
+		page.NextCursor = newVideoCursor(params.Sort, page.Videos[params.Limit-1]).encode()
+	}
+	return page, nil
+}
+
+func nullCondition(column string, present bool) string {
+	if present {
+		return column + " IS NOT NULL"
+	}
+	return column + " IS NULL"
+}
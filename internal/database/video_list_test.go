@@ -0,0 +1,64 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVideoCursorRoundTrip(t *testing.T) {
+	duration := 12.5
+	video := Video{
+		ID:        uuid.New(),
+		CreatedAt: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		CreateVideoParams: CreateVideoParams{
+			Title: "My video",
+		},
+		Duration: &duration,
+	}
+
+	for _, sort := range []VideoSort{VideoSortNewest, VideoSortOldest, VideoSortTitle, VideoSortDuration} {
+		t.Run(string(sort), func(t *testing.T) {
+			want := newVideoCursor(sort, video)
+			got, err := decodeVideoCursor(want.encode(), sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != want.ID || got.Title != want.Title || got.Duration != want.Duration ||
+				(got.CreatedAt == nil) != (want.CreatedAt == nil) ||
+				(got.CreatedAt != nil && !got.CreatedAt.Equal(*want.CreatedAt)) {
+				t.Errorf("decoded %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeVideoCursorInvalid(t *testing.T) {
+	encode := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+	id := uuid.New().String()
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   VideoSort
+	}{
+		{name: "not base64", cursor: "not a cursor!", sort: VideoSortNewest},
+		{name: "not json", cursor: encode("nope"), sort: VideoSortNewest},
+		{name: "other sort", cursor: newVideoCursor(VideoSortTitle, Video{ID: uuid.New()}).encode(), sort: VideoSortNewest},
+		{name: "missing id", cursor: encode(`{"s":"title","t":"a"}`), sort: VideoSortTitle},
+		{name: "missing created_at", cursor: encode(`{"s":"newest","id":"` + id + `"}`), sort: VideoSortNewest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodeVideoCursor(tc.cursor, tc.sort)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeVideoCursor() error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
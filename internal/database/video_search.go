@@ -0,0 +1,196 @@
+package database
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Search matches are wrapped in these private-use runes by the database, then
+// swapped for <mark> tags after the rest of the snippet is HTML-escaped.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+type SearchVideosParams struct {
+	UserID uuid.UUID
+	Query  string
+	Limit  int
+}
+
+type VideoSearchResult struct {
+	Video
+	Rank               float64 `json:"rank"`
+	TitleSnippet       string  `json:"title_snippet"`
+	DescriptionSnippet string  `json:"description_snippet"`
+}
+
+// SearchTerms splits a free-text query into the words that will be matched.
+// Punctuation is dropped so user input can never form query-language syntax.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchVideos ranks a user's videos against query, best match first. Every
+// term must match a word in the title or description, either whole or as a prefix.
+func (c Client) SearchVideos(params SearchVideosParams) ([]VideoSearchResult, error) {
+	terms := SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return []VideoSearchResult{}, nil
+	}
+	if params.Limit <= 0 {
+		params.Limit = DefaultVideoPageSize
+	}
+	if params.Limit > MaxVideoPageSize {
+		params.Limit = MaxVideoPageSize
+	}
+
+	if c.dialect == dialectSQLite && !c.fts5 {
+		return c.searchVideosLike(params, terms)
+	}
+
+	var query string
+	var match string
+	if c.dialect == dialectPostgres {
+		query = `
+		SELECT` + videoColumns + `,
+			ts_rank(search_vector, q) AS rank,
+			ts_headline('english', title, q, 'HighlightAll=true, StartSel=` + highlightStart + `, StopSel=` + highlightStop + `'),
+			ts_headline('english', COALESCE(description, ''), q, 'MaxFragments=1, MaxWords=20, MinWords=5, StartSel=` + highlightStart + `, StopSel=` + highlightStop + `')
+		FROM videos, to_tsquery('english', ?) q
+		WHERE search_vector @@ q AND user_id = ? AND deleted_at IS NULL
+		ORDER BY rank DESC, created_at DESC
+		LIMIT ?
+		`
+		for i, term := range terms {
+			terms[i] = term + ":*"
+		}
+		match = strings.Join(terms, " & ")
+	} else {
+		query = `
+		SELECT` + videoColumns + `,
+			f.rank,
+			f.title_snippet,
+			f.description_snippet
+		FROM videos
+		JOIN (
+			SELECT
+				video_id,
+				-bm25(videos_fts, 0.0, 10.0, 1.0) AS rank,
+				highlight(videos_fts, 1, '` + highlightStart + `', '` + highlightStop + `') AS title_snippet,
+				snippet(videos_fts, 2, '` + highlightStart + `', '` + highlightStop + `', '…', 20) AS description_snippet
+			FROM videos_fts
+			WHERE videos_fts MATCH ?
+		) f ON f.video_id = videos.id
+		WHERE user_id = ? AND deleted_at IS NULL
+		ORDER BY f.rank DESC, created_at DESC
+		LIMIT ?
+		`
+		for i, term := range terms {
+			terms[i] = `"` + term + `"*`
+		}
+		match = strings.Join(terms, " ")
+	}
+
+	results, err := c.querySearchResults(query, match, params.UserID, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].TitleSnippet = markHighlights(results[i].TitleSnippet)
+		results[i].DescriptionSnippet = markHighlights(results[i].DescriptionSnippet)
+	}
+	return results, nil
+}
+
+// searchVideosLike is SearchVideos for SQLite built without FTS5. Terms match
+// anywhere in a word, every match ranks the same and snippets are the whole
+// title and description.
+func (c Client) searchVideosLike(params SearchVideosParams, terms []string) ([]VideoSearchResult, error) {
+	query := `
+	SELECT` + videoColumns + `, 0, title, COALESCE(description, '')
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NULL`
+	args := []any{params.UserID}
+	for _, term := range terms {
+		// terms are only letters and digits, so they can't contain LIKE wildcards
+		query += `
+		AND (LOWER(title) LIKE ? OR LOWER(COALESCE(description, '')) LIKE ?)`
+		pattern := "%" + term + "%"
+		args = append(args, pattern, pattern)
+	}
+	query += `
+	ORDER BY created_at DESC
+	LIMIT ?`
+	args = append(args, params.Limit)
+
+	results, err := c.querySearchResults(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].TitleSnippet = markHighlights(highlightTerms(results[i].TitleSnippet, terms))
+		results[i].DescriptionSnippet = markHighlights(highlightTerms(results[i].DescriptionSnippet, terms))
+	}
+	return results, nil
+}
+
+// querySearchResults runs a search query whose columns are the video's, the
+// rank and the title and description snippets. The snippets are left raw for
+// the caller to pass through markHighlights.
+func (c Client) querySearchResults(query string, args ...any) ([]VideoSearchResult, error) {
+	rows, err := c.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var result VideoSearchResult
+		result.Video, err = scanVideo(rows, &result.Rank, &result.TitleSnippet, &result.DescriptionSnippet)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	videos := make([]Video, len(results))
+	for i := range results {
+		videos[i] = results[i].Video
+	}
+	err = c.attachTags(videos)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Tags = videos[i].Tags
+	}
+	return results, nil
+}
+
+// highlightTerms wraps every occurrence of the terms in the same markers the
+// database uses, for markHighlights to turn into <mark> tags.
+func highlightTerms(snippet string, terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	pattern := regexp.MustCompile(`(?i)` + strings.Join(quoted, "|"))
+	return pattern.ReplaceAllString(snippet, highlightStart+"$0"+highlightStop)
+}
+
+func markHighlights(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
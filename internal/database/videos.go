@@ -3,29 +3,41 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ThumbnailURL *string    `json:"thumbnail_url"`
+	VideoURL     *string    `json:"video_url"`
+	AspectRatio  *string    `json:"aspect_ratio"`
+	Duration     *float64   `json:"duration"`
+	Version      int        `json:"version"`
+	Tags         []string   `json:"tags"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+
+	// VideoSize and ThumbnailSize are the stored bytes counted against the
+	// owner's quota.
+	VideoSize     int64 `json:"video_size"`
+	ThumbnailSize int64 `json:"thumbnail_size"`
 	CreateVideoParams
 }
 
+// ErrVideoVersionConflict means the video changed since the caller last read it.
+var ErrVideoVersionConflict = errors.New("video was modified concurrently")
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,37 +45,39 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
-
-	rows, err := c.db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+		aspect_ratio,
+		duration,
+		video_size,
+		thumbnail_size,
+		version,
+		deleted_at,
+		user_id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	videos := []Video{}
-	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
-			return nil, err
-		}
-		videos = append(videos, video)
+// scanVideo scans videoColumns, followed by any extra selected columns.
+func scanVideo(row rowScanner, extra ...any) (Video, error) {
+	var video Video
+	dest := []any{
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.AspectRatio,
+		&video.Duration,
+		&video.VideoSize,
+		&video.ThumbnailSize,
+		&video.Version,
+		&video.DeletedAt,
+		&video.UserID,
 	}
-
-	return videos, nil
+	err := row.Scan(append(dest, extra...)...)
+	return video, err
 }
 
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
@@ -78,7 +92,7 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		user_id
 	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := c.exec(query, id, params.Title, params.Description, params.UserID)
 	if err != nil {
 		return Video{}, err
 	}
@@ -86,31 +100,24 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	return c.GetVideo(id)
 }
 
+// GetVideo returns the video, or a zero Video if it doesn't exist or is in the trash.
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+	return c.getVideo(id, false)
+}
+
+// GetTrashedVideo returns the video only if it is in the trash.
+func (c Client) GetTrashedVideo(id uuid.UUID) (Video, error) {
+	return c.getVideo(id, true)
+}
+
+func (c Client) getVideo(id uuid.UUID, trashed bool) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
-	WHERE id = ?
+	WHERE id = ? AND ` + nullCondition("deleted_at", trashed) + `
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.queryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -118,38 +125,120 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		return Video{}, err
 	}
 
-	return video, nil
+	videos := []Video{video}
+	err = c.attachTags(videos)
+	if err != nil {
+		return Video{}, err
+	}
+	return videos[0], nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
-	query := `
+// updateVideoQuery only sets the metadata clients can edit. Files and their
+// sizes change through SetVideoFile and SetThumbnailFile, which enforce quotas.
+const updateVideoQuery = `
 	UPDATE videos
 	SET
 		title = ?,
 		description = ?,
-		thumbnail_url = ?,
-		video_url = ?,
-		user_id = ?
-	WHERE id = ?
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1
+	WHERE id = ? AND version = ?
 	`
 
-	_, err := c.db.Exec(
-		query,
-		video.Title,
-		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		video.UserID,
-		video.ID,
-	)
+// UpdateVideoIfVersion saves video's metadata only if the stored version
+// still equals video.Version, returning ErrVideoVersionConflict otherwise.
+func (c Client) UpdateVideoIfVersion(video Video) (Video, error) {
+	result, err := c.exec(updateVideoQuery, video.Title, video.Description, video.ID, video.Version)
+	if err != nil {
+		return Video{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Video{}, err
+	}
+	if n == 0 {
+		return Video{}, fmt.Errorf("%w: expected version %d", ErrVideoVersionConflict, video.Version)
+	}
+	return c.GetVideo(video.ID)
+}
+
+// TrashVideo soft-deletes a video; it can be restored until it is purged.
+func (c Client) TrashVideo(id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	_, err := c.exec(query, id)
 	return err
 }
 
+func (c Client) RestoreVideo(id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = NULL
+	WHERE id = ?
+	`
+	_, err := c.exec(query, id)
+	return err
+}
+
+// GetTrashedVideos lists a user's trashed videos, most recently deleted first.
+func (c Client) GetTrashedVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id DESC
+	`
+	return c.queryVideos(query, userID)
+}
+
+// GetExpiredTrash lists videos that were trashed before cutoff, oldest first,
+// skipping the first offset of them.
+func (c Client) GetExpiredTrash(cutoff time.Time, limit, offset int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NOT NULL AND deleted_at < ?
+	ORDER BY deleted_at ASC, id ASC
+	LIMIT ? OFFSET ?
+	`
+	return c.queryVideos(query, c.dialect.timeArg(cutoff), limit, offset)
+}
+
+func (c Client) queryVideos(query string, args ...any) ([]Video, error) {
+	rows, err := c.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = c.attachTags(videos)
+	if err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// DeleteVideo permanently removes a video row; use TrashVideo for user-facing deletes.
 func (c Client) DeleteVideo(id uuid.UUID) error {
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
+	_, err := c.exec(query, id)
 	return err
 }
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUpdateVideoIfVersion(t *testing.T) {
+	c := newTestClient(t)
+	user, err := c.CreateUser(CreateUserParams{Email: "user@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := c.CreateVideo(CreateVideoParams{Title: "old", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := video
+	edited.Title = "new"
+	edited.Description = "described"
+	// only metadata is saved, whatever else the caller changed
+	url := "https://example.com/video.mp4"
+	edited.VideoURL = &url
+	edited.ThumbnailURL = &url
+	edited.UserID = uuid.New()
+	updated, err := c.UpdateVideoIfVersion(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "new" || updated.Description != "described" || updated.Version != video.Version+1 {
+		t.Errorf("metadata not saved: %+v", updated)
+	}
+	if updated.VideoURL != nil || updated.ThumbnailURL != nil || updated.UserID != user.ID {
+		t.Errorf("update changed more than metadata: %+v", updated)
+	}
+
+	// video still has the version the first update replaced
+	_, err = c.UpdateVideoIfVersion(video)
+	if !errors.Is(err, ErrVideoVersionConflict) {
+		t.Errorf("stale update: got error %v, want %v", err, ErrVideoVersionConflict)
+	}
+}
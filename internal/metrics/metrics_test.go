@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(reg *Registry)
+		want  string
+	}{
+		{
+			name: "counter without labels",
+			setup: func(reg *Registry) {
+				c := reg.NewCounter("jobs_total", "Jobs run.")
+				c.Inc()
+				c.Add(2.5)
+			},
+			want: `# HELP jobs_total Jobs run.
+# TYPE jobs_total counter
+jobs_total 3.5
+`,
+		},
+		{
+			name: "counter series sorted by label values",
+			setup: func(reg *Registry) {
+				c := reg.NewCounter("requests_total", "Requests handled.", "method", "status")
+				c.Inc("POST", "201")
+				c.Inc("GET", "200")
+				c.Inc("GET", "200")
+			},
+			want: `# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 2
+requests_total{method="POST",status="201"} 1
+`,
+		},
+		{
+			name: "escaping",
+			setup: func(reg *Registry) {
+				c := reg.NewCounter("escaped_total", "Back\\slash and\nnewline.", "path")
+				c.Inc(`a"b\c` + "\n")
+			},
+			want: `# HELP escaped_total Back\\slash and\nnewline.
+# TYPE escaped_total counter
+escaped_total{path="a\"b\\c\n"} 1
+`,
+		},
+		{
+			name: "histogram buckets are cumulative",
+			setup: func(reg *Registry) {
+				h := reg.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+				h.Observe(0.05, "/a")
+				h.Observe(0.1, "/a")
+				h.Observe(0.5, "/a")
+				h.Observe(5, "/a")
+			},
+			want: `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 3
+latency_seconds_bucket{route="/a",le="+Inf"} 4
+latency_seconds_sum{route="/a"} 5.65
+latency_seconds_count{route="/a"} 4
+`,
+		},
+		{
+			name: "metrics without observations keep their header",
+			setup: func(reg *Registry) {
+				reg.NewHistogram("empty_seconds", "Nothing yet.", DefaultBuckets)
+			},
+			want: `# HELP empty_seconds Nothing yet.
+# TYPE empty_seconds histogram
+`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := NewRegistry()
+			tc.setup(reg)
+			var sb strings.Builder
+			n, err := reg.WriteTo(&sb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sb.String() != tc.want {
+				t.Errorf("WriteTo() wrote\n%s\nwant\n%s", sb.String(), tc.want)
+			}
+			if n != int64(sb.Len()) {
+				t.Errorf("WriteTo() = %d, wrote %d bytes", n, sb.Len())
+			}
+		})
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	c := NewRegistry().NewCounter("requests_total", "Requests handled.", "method")
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc with too few label values didn't panic")
+		}
+	}()
+	c.Inc()
+}
+
+func TestServeHTTP(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("jobs_total", "Jobs run.").Inc()
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), "jobs_total 1\n") {
+		t.Errorf("body missing the counter:\n%s", rec.Body)
+	}
+}
@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{
+		Issuer:   "https://idp.example.com",
+		ClientID: "tubely",
+		keys:     map[string]any{"k1": pub},
+	}
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://idp.example.com",
+			"aud":   "tubely",
+			"sub":   "user-1",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "n-1",
+			"email": "user@example.com",
+		}
+	}
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	hmacToken.Header["kid"] = "k1"
+	// signed with the public key as an HMAC secret, the classic alg confusion attack
+	hmacSigned, err := hmacToken.SignedString([]byte(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noneSigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: sign(validClaims())},
+		{name: "wrong issuer", token: sign(with(validClaims(), "iss", "https://evil.example.com")), wantErr: true},
+		{name: "wrong audience", token: sign(with(validClaims(), "aud", "someone-else")), wantErr: true},
+		{name: "wrong nonce", token: sign(with(validClaims(), "nonce", "n-2")), wantErr: true},
+		{name: "expired", token: sign(with(validClaims(), "exp", time.Now().Add(-time.Hour).Unix())), wantErr: true},
+		{name: "missing exp", token: sign(without(validClaims(), "exp")), wantErr: true},
+		{name: "missing sub", token: sign(without(validClaims(), "sub")), wantErr: true},
+		{name: "HS256", token: hmacSigned, wantErr: true},
+		{name: "alg none", token: noneSigned, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := p.verifyIDToken(context.Background(), tc.token, "n-1")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("verifyIDToken() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && (claims.Subject != "user-1" || claims.Email != "user@example.com") {
+				t.Errorf("verifyIDToken() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func with(claims jwt.MapClaims, key string, value any) jwt.MapClaims {
+	claims[key] = value
+	return claims
+}
+
+func without(claims jwt.MapClaims, key string) jwt.MapClaims {
+	delete(claims, key)
+	return claims
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// the example from RFC 7636 appendix B
+	got := codeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got != want {
+		t.Errorf("codeChallenge() = %q, want %q", got, want)
+	}
+}
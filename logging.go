@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs accepted from clients to ones that are
+// safe to echo back and log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// loadLogger returns a JSON logger writing to stdout at LOG_LEVEL: "debug",
+// "info" (the default), "warn" or "error".
+func loadLogger() (*slog.Logger, error) {
+	var level slog.Level
+	value := os.Getenv("LOG_LEVEL")
+	if value != "" {
+		err := level.UnmarshalText([]byte(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q, expected debug, info, warn or error", value)
+		}
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})), nil
+}
+
+// requestLog is what's known about a request for its log lines. Handlers and
+// middleware further down the chain fill in the user and video as they learn
+// them, so it must only be changed from the request's goroutine.
+type requestLog struct {
+	requestID string
+	userID    uuid.UUID
+	videoID   uuid.UUID
+
+	// errMsg and err are set by respondWithError.
+	errMsg string
+	err    error
+}
+
+func (l *requestLog) attrs() []any {
+	attrs := []any{}
+	if l.requestID != "" {
+		attrs = append(attrs, slog.String("request_id", l.requestID))
+	}
+	if l.userID != uuid.Nil {
+		attrs = append(attrs, slog.String("user_id", l.userID.String()))
+	}
+	if l.videoID != uuid.Nil {
+		attrs = append(attrs, slog.String("video_id", l.videoID.String()))
+	}
+	return attrs
+}
+
+type requestLogContextKey struct{}
+
+func requestLogFrom(ctx context.Context) *requestLog {
+	l, _ := ctx.Value(requestLogContextKey{}).(*requestLog)
+	return l
+}
+
+// logger returns the default logger with the request ID, user and video of
+// ctx, if it has any.
+func logger(ctx context.Context) *slog.Logger {
+	l := requestLogFrom(ctx)
+	if l == nil {
+		return slog.Default()
+	}
+	return slog.Default().With(l.attrs()...)
+}
+
+// withLogUser attributes ctx's log lines, and those of the request it belongs
+// to, to the user.
+func withLogUser(ctx context.Context, userID uuid.UUID) context.Context {
+	l := requestLogFrom(ctx)
+	if l == nil {
+		l = &requestLog{}
+		ctx = context.WithValue(ctx, requestLogContextKey{}, l)
+	}
+	l.userID = userID
+	return ctx
+}
+
+// withLogVideo attributes ctx's log lines, and those of the request it
+// belongs to, to the video.
+func withLogVideo(ctx context.Context, videoID uuid.UUID) context.Context {
+	l := requestLogFrom(ctx)
+	if l == nil {
+		l = &requestLog{}
+		ctx = context.WithValue(ctx, requestLogContextKey{}, l)
+	}
+	l.videoID = videoID
+	return ctx
+}
+
+// logRequests gives every request an ID, taken from its X-Request-ID header
+// when the client sent a usable one, echoes it in the response and logs a
+// line for the request once it's been handled. It also records the request's
+// metrics.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		l := &requestLog{requestID: requestID}
+		rec := &statusRecorder{ResponseWriter: w, log: l}
+		// the mux sets the pattern and path values on the request it's given
+		r = r.WithContext(context.WithValue(r.Context(), requestLogContextKey{}, l))
+		next.ServeHTTP(rec, r)
+
+		if l.videoID == uuid.Nil {
+			videoID, err := uuid.Parse(r.PathValue("videoID"))
+			if err == nil {
+				l.videoID = videoID
+			}
+		}
+
+		elapsed := time.Since(start)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		observeRequest(r.Method, routePattern(r), status, elapsed)
+
+		attrs := append(l.attrs(),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", routePattern(r)),
+			slog.Int("status", status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Float64("latency_ms", milliseconds(elapsed)),
+			slog.String("remote_ip", clientIP(r)),
+		)
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		if l.errMsg != "" {
+			attrs = append(attrs, slog.String("error_message", l.errMsg))
+		}
+		if l.err != nil {
+			attrs = append(attrs, slog.String("error", l.err.Error()))
+		}
+		slog.Default().Log(r.Context(), level, "request", attrs...)
+	})
+}
+
+// routePattern returns the mux pattern that matched r, without its method,
+// or "" if none did.
+func routePattern(r *http.Request) string {
+	_, pattern, ok := strings.Cut(r.Pattern, " ")
+	if !ok {
+		return r.Pattern
+	}
+	return pattern
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// statusRecorder records the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	log    *requestLog
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// loginThrottlePolicy locks logins for a key once it has threshold failures
+// within window. Each further failure doubles the lockout, up to maxLockout.
+type loginThrottlePolicy struct {
+	threshold   int
+	window      time.Duration
+	baseLockout time.Duration
+	maxLockout  time.Duration
+}
+
+var (
+	// accountLoginPolicy protects a single account from password guessing.
+	accountLoginPolicy = loginThrottlePolicy{
+		threshold:   5,
+		window:      24 * time.Hour,
+		baseLockout: time.Minute,
+		maxLockout:  time.Hour,
+	}
+	// ipLoginPolicy slows down one client guessing across many accounts. It
+	// is looser since many users can share an address.
+	ipLoginPolicy = loginThrottlePolicy{
+		threshold:   20,
+		window:      time.Hour,
+		baseLockout: time.Minute,
+		maxLockout:  time.Hour,
+	}
+)
+
+func (p loginThrottlePolicy) lockout(failures int) time.Duration {
+	if failures < p.threshold {
+		return 0
+	}
+	lockout := float64(p.baseLockout) * math.Pow(2, float64(failures-p.threshold))
+	if lockout > float64(p.maxLockout) {
+		return p.maxLockout
+	}
+	return time.Duration(lockout)
+}
+
+// Accounts are throttled by email rather than user ID so that unknown emails
+// lock the same way known ones do, and lockouts don't reveal who has an account.
+func accountThrottleKey(email string) string {
+	return "email:" + normalizeEmail(email)
+}
+
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// loginLockedFor returns how long logins for email from this client are
+// locked, or 0 if they may go ahead.
+func (cfg *apiConfig) loginLockedFor(r *http.Request, email string) (time.Duration, error) {
+	var lockedFor time.Duration
+	for _, key := range []string{accountThrottleKey(email), ipThrottleKey(r)} {
+		throttle, err := cfg.db.GetLoginThrottle(key)
+		if err != nil {
+			return 0, err
+		}
+		lockedFor = max(lockedFor, throttle.LockedFor(time.Now()))
+	}
+	return lockedFor, nil
+}
+
+// recordLoginFailure counts a failed password or second factor against both
+// the account and the client, locking either once it has too many.
+func (cfg *apiConfig) recordLoginFailure(r *http.Request, email string) error {
+	keys := []struct {
+		key    string
+		policy loginThrottlePolicy
+	}{
+		{accountThrottleKey(email), accountLoginPolicy},
+		{ipThrottleKey(r), ipLoginPolicy},
+	}
+	for _, k := range keys {
+		throttle, err := cfg.db.RecordLoginFailure(k.key, k.policy.window)
+		if err != nil {
+			return err
+		}
+		lockout := k.policy.lockout(throttle.Failures)
+		if lockout == 0 {
+			continue
+		}
+		err = cfg.db.LockLogin(k.key, time.Now().Add(lockout))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearAccountThrottle resets the account's failures after a successful
+// login. The client's aren't reset, or an attacker could clear them by
+// logging into an account of their own between guesses.
+func (cfg *apiConfig) clearAccountThrottle(email string) error {
+	return cfg.db.ClearLoginThrottle(accountThrottleKey(email))
+}
+
+func respondWithLoginLocked(w http.ResponseWriter, lockedFor time.Duration) {
+	seconds := int(math.Ceil(lockedFor.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, fmt.Sprintf("Too many failed login attempts, try again in %d seconds", seconds), nil)
+}
+
+// dummyPasswordHash is compared against when the email is unknown or the
+// user has no password, so those logins take as long as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("not the password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestLoginThrottleLockout(t *testing.T) {
+	policy := loginThrottlePolicy{
+		threshold:   3,
+		window:      time.Hour,
+		baseLockout: time.Minute,
+		maxLockout:  10 * time.Minute,
+	}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Minute},
+		{failures: 4, want: 2 * time.Minute},
+		{failures: 6, want: 8 * time.Minute},
+		{failures: 7, want: 10 * time.Minute},
+		{failures: 100, want: 10 * time.Minute},
+	}
+	for _, tc := range tests {
+		got := policy.lockout(tc.failures)
+		if got != tc.want {
+			t.Errorf("lockout(%d) = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestLoginLockoutIgnoresEmailCase(t *testing.T) {
+	cfg := newTestConfig(t)
+	hashedPassword, err := auth.HashPassword("right")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.db.CreateUser(database.CreateUserParams{Email: "user@example.com", Password: hashedPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := login(cfg, " User@Example.com", "right")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login with different case: got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	emails := []string{"USER@example.com", "user@EXAMPLE.com", "User@example.com"}
+	for i := range accountLoginPolicy.threshold {
+		rec := login(cfg, emails[i%len(emails)], "wrong")
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failed login %d: got status %d, want %d", i, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	rec = login(cfg, "user@example.com", "right")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("login after lockout: got status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("locked login has no Retry-After header")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+)
+
+// loadMailer picks the mailer named by MAILER: "log" prints messages to the
+// server log, "file" writes them to MAIL_DIR and "smtp" sends them through
+// SMTP_ADDR. Logged messages include password reset and verification tokens,
+// so "log" is only allowed, and only the default, when PLATFORM is dev.
+func loadMailer() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Tubely <no-reply@tubely.local>"
+	}
+
+	kind := os.Getenv("MAILER")
+	dev := os.Getenv("PLATFORM") == "dev"
+	if kind == "" && dev {
+		kind = "log"
+	}
+
+	switch kind {
+	case "":
+		return nil, fmt.Errorf("MAILER environment variable must be set unless PLATFORM is dev")
+	case "log":
+		if !dev {
+			return nil, fmt.Errorf("MAILER log prints tokens to the server log and is only allowed when PLATFORM is dev")
+		}
+		return mailer.LogMailer{}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		return mailer.FileMailer{Dir: dir, From: from}, nil
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR environment variable must be set when MAILER is smtp")
+		}
+		return mailer.SMTPMailer{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q, expected log, file or smtp", kind)
+	}
+}
+
+// sendMailInBackground sends msg without making the request wait on the mail
+// server. Failures are only logged.
+func (cfg *apiConfig) sendMailInBackground(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		err := cfg.mailer.Send(ctx, msg)
+		if err != nil {
+			slog.Error("Couldn't send email", "subject", msg.Subject, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+)
+
+func TestLoadMailer(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		kind     string
+		wantLog  bool
+		wantErr  bool
+	}{
+		{name: "dev defaults to log", platform: "dev", wantLog: true},
+		{name: "dev allows log", platform: "dev", kind: "log", wantLog: true},
+		{name: "unset outside dev", platform: "prod", wantErr: true},
+		{name: "log outside dev", platform: "prod", kind: "log", wantErr: true},
+		{name: "file outside dev", platform: "prod", kind: "file"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("PLATFORM", tc.platform)
+			t.Setenv("MAILER", tc.kind)
+
+			m, err := loadMailer()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("loadMailer() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			_, isLog := m.(mailer.LogMailer)
+			if isLog != tc.wantLog {
+				t.Errorf("loadMailer() = %T, want log mailer %v", m, tc.wantLog)
+			}
+		})
+	}
+}
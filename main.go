@@ -2,21 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/oidc"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
-	jwtSecret        string
+	db               database.Store
+	jwtKeys          *auth.KeySet
+	oidc             *oidc.Provider // nil unless single sign-on is configured
+	mailer           mailer.Mailer
+	passwordResetURL string
 	platform         string
 	filepathRoot     string
 	assetsRoot       string
@@ -25,24 +34,96 @@ type apiConfig struct {
 	s3Region         string
 	s3CfDistribution string
 	port             string
+	trashRetention   time.Duration
+
+	// emailVerification is what unverified users are blocked from
+	emailVerification    emailVerificationPolicy
+	emailVerificationURL string
+
+	storageQuota storageQuota
+
+	uploadConfig uploadConfig
+
+	// metricsToken guards /metrics when set
+	metricsToken string
 }
 
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
-	if pathToDB == "" {
-		log.Fatal("DB_URL must be set")
+	logger, err := loadLogger()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// also sends the standard library's log output through it
+	slog.SetDefault(logger)
+
+	// `tubely gen-jwt-key ...` only writes a key file and exits
+	if len(os.Args) > 1 && os.Args[1] == "gen-jwt-key" {
+		err := runGenerateJWTKeyCommand(os.Args[2:])
+		if err != nil {
+			log.Fatalf("Couldn't generate signing key: %v", err)
+		}
+		return
 	}
 
-	db, err := database.NewClient(pathToDB)
+	db, err := openDatabase()
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
+	defer db.Close()
+
+	// `tubely migrate ...` only touches the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrateCommand(db, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	err = db.MigrateUp()
+	if err != nil {
+		log.Fatalf("Couldn't migrate database: %v", err)
+	}
+
+	// `tubely set-role <email> <role>` grants a role, e.g. to create the first admin
+	if len(os.Args) > 1 && os.Args[1] == "set-role" {
+		err = runSetRoleCommand(db, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Couldn't set role: %v", err)
+		}
+		return
+	}
+
+	jwtKeys, err := loadJWTKeys()
+	if err != nil {
+		log.Fatalf("Couldn't load JWT signing keys: %v", err)
+	}
+
+	oidcProvider, err := loadOIDCProvider()
+	if err != nil {
+		log.Fatalf("Couldn't set up OpenID Connect: %v", err)
+	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	mailSender, err := loadMailer()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	emailVerification, err := loadEmailVerificationPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storageQuota, err := loadStorageQuota()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	uploadConfig, err := loadUploadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	platform := os.Getenv("PLATFORM")
@@ -80,6 +161,16 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	trashRetention, err := durationEnv("TRASH_RETENTION", defaultTrashRetention)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	trashPurgeInterval, err := durationEnv("TRASH_PURGE_INTERVAL", defaultTrashPurgeInterval)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// get AWS credentials and config
 	awsCfg, err := config.LoadDefaultConfig(
 		context.Background(),        // empty context for setup
@@ -96,7 +187,10 @@ func main() {
 
 	cfg := apiConfig{
 		db:               db,
-		jwtSecret:        jwtSecret,
+		jwtKeys:          jwtKeys,
+		oidc:             oidcProvider,
+		mailer:           mailSender,
+		passwordResetURL: os.Getenv("PASSWORD_RESET_URL"),
 		platform:         platform,
 		filepathRoot:     filepathRoot,
 		assetsRoot:       assetsRoot,
@@ -105,6 +199,16 @@ func main() {
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
 		port:             port,
+		trashRetention:   trashRetention,
+
+		emailVerification:    emailVerification,
+		emailVerificationURL: os.Getenv("EMAIL_VERIFICATION_URL"),
+
+		storageQuota: storageQuota,
+
+		uploadConfig: uploadConfig,
+
+		metricsToken: os.Getenv("METRICS_TOKEN"),
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -119,27 +223,106 @@ func main() {
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
+	mux.HandleFunc("GET /metrics", cfg.handlerMetrics)
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/2fa", cfg.handlerLoginTwoFactor)
+	if cfg.oidc != nil {
+		mux.HandleFunc("GET /api/oidc/login", cfg.handlerOIDCLogin)
+		mux.HandleFunc("GET /api/oidc/callback", cfg.handlerOIDCCallback)
+	}
+	mux.HandleFunc("POST /api/forgot_password", cfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/reset_password", cfg.handlerResetPassword)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	mux.HandleFunc("GET /api/sessions", cfg.requireLogin(cfg.handlerSessionsList))
+	mux.HandleFunc("DELETE /api/sessions", cfg.requireLogin(cfg.handlerSessionsRevokeAll))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.requireLogin(cfg.handlerSessionRevoke))
+	mux.HandleFunc("POST /api/api_keys", cfg.requireLogin(cfg.handlerAPIKeyCreate))
+	mux.HandleFunc("GET /api/api_keys", cfg.requireLogin(cfg.handlerAPIKeysRetrieve))
+	mux.HandleFunc("DELETE /api/api_keys/{keyID}", cfg.requireLogin(cfg.handlerAPIKeyDelete))
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("POST /api/verify_email", cfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/me/verification_email", cfg.requireLogin(cfg.handlerVerificationEmailResend))
+	mux.HandleFunc("POST /api/users/me/totp", cfg.requireLogin(cfg.handlerTOTPEnroll))
+	mux.HandleFunc("POST /api/users/me/totp/confirm", cfg.requireLogin(cfg.handlerTOTPConfirm))
+	mux.HandleFunc("DELETE /api/users/me/totp", cfg.requireLogin(cfg.handlerTOTPDisable))
+	mux.HandleFunc("GET /api/users/me/usage", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerUsageGet))
 
-	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
-	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("POST /api/videos", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoMetaCreate))
+	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.requireVerifiedEmail(cfg.handlerUploadThumbnail)))
+	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.requireVerifiedEmail(cfg.handlerUploadVideo)))
+	mux.HandleFunc("GET /api/videos", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerVideosRetrieve))
+	mux.HandleFunc("GET /api/videos/search", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerVideosSearch))
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoMetaUpdate))
 
-	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoMetaDelete))
+	mux.HandleFunc("GET /api/videos/trash", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerVideosTrashRetrieve))
+	mux.HandleFunc("POST /api/videos/{videoID}/restore", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoRestore))
 
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("GET /api/tags", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerTagsRetrieve))
+	mux.HandleFunc("POST /api/videos/{videoID}/tags", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoTagsAdd))
+	mux.HandleFunc("DELETE /api/videos/{videoID}/tags/{tag}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoTagsRemove))
+
+	mux.HandleFunc("POST /api/playlists", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistCreate))
+	mux.HandleFunc("GET /api/playlists", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerPlaylistsRetrieve))
+	mux.HandleFunc("GET /api/playlists/{playlistID}", cfg.handlerPlaylistGet)
+	mux.HandleFunc("PATCH /api/playlists/{playlistID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistUpdate))
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistDelete))
+	mux.HandleFunc("POST /api/playlists/{playlistID}/videos", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistEntryAdd))
+	mux.HandleFunc("PUT /api/playlists/{playlistID}/videos", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistReorder))
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}/videos/{videoID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistEntryRemove))
+
+	mux.HandleFunc("POST /admin/reset", cfg.requireRole(database.RoleAdmin, cfg.handlerReset))
+	mux.HandleFunc("GET /admin/users", cfg.requireRole(database.RoleAdmin, cfg.handlerAdminUsersRetrieve))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", cfg.requireRole(database.RoleAdmin, cfg.handlerAdminUserRoleUpdate))
+	mux.HandleFunc("POST /admin/users/{userID}/disable", cfg.requireRole(database.RoleAdmin, cfg.handlerAdminUserDisable))
+	mux.HandleFunc("POST /admin/users/{userID}/enable", cfg.requireRole(database.RoleAdmin, cfg.handlerAdminUserEnable))
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", cfg.requireRole(database.RoleAdmin, cfg.handlerAdminUserUnlock))
+	mux.HandleFunc("GET /admin/users/{userID}/videos", cfg.requireRole(database.RoleModerator, cfg.handlerAdminUserVideosRetrieve))
+
+	go cfg.runTrashPurger(context.Background(), trashPurgeInterval)
 
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: logRequests(mux),
 	}
 
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
+	slog.Info("Serving on: http://localhost:" + port + "/app/")
 	log.Fatal(srv.ListenAndServe())
 }
+
+// openDatabase connects to Postgres when DB_URL is set, otherwise to the SQLite file at DB_PATH.
+func openDatabase() (database.Store, error) {
+	var client database.Client
+	var err error
+	dbURL := os.Getenv("DB_URL")
+	pathToDB := os.Getenv("DB_PATH")
+	switch {
+	case dbURL != "":
+		client, err = database.NewPostgresClient(dbURL)
+	case pathToDB != "":
+		client, err = database.NewClient(pathToDB)
+	default:
+		return nil, errors.New("DB_URL or DB_PATH must be set")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client.WithQueryObserver(observeDBQuery), nil
+}
+
+// durationEnv parses an optional duration variable such as "720h", falling back to def when unset.
+func durationEnv(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration like 720h: %q", key, value)
+	}
+	return d, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// runMediaCommand runs an ffmpeg or ffprobe command, logging and recording
+// metrics for how long it took and whether it failed.
+func runMediaCommand(ctx context.Context, cmd *exec.Cmd) error {
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start)
+
+	command := filepath.Base(cmd.Path)
+	mediaCommandDuration.Observe(elapsed.Seconds(), command)
+	attrs := []any{
+		slog.String("command", command),
+		slog.Float64("duration_ms", milliseconds(elapsed)),
+	}
+	if err != nil {
+		mediaCommandFailuresTotal.Inc(command)
+		logger(ctx).Error("Media command failed", append(attrs, slog.String("error", err.Error()))...)
+		return err
+	}
+	logger(ctx).Info("Media command finished", attrs...)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/metrics"
+)
+
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	httpRequestsTotal = metricsRegistry.NewCounter(
+		"tubely_http_requests_total",
+		"HTTP requests handled, by method, route pattern and status code.",
+		"method", "route", "status",
+	)
+	httpRequestDuration = metricsRegistry.NewHistogram(
+		"tubely_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by method and route pattern.",
+		metrics.DefaultBuckets,
+		"method", "route",
+	)
+
+	uploadBytesTotal = metricsRegistry.NewCounter(
+		"tubely_upload_bytes_total",
+		"Bytes received in uploads, by kind (video or thumbnail).",
+		"kind",
+	)
+	uploadDuration = metricsRegistry.NewHistogram(
+		"tubely_upload_duration_seconds",
+		"Time taken to receive uploads, by kind (video or thumbnail).",
+		[]float64{.1, .5, 1, 5, 10, 30, 60, 120, 300, 600},
+		"kind",
+	)
+
+	mediaCommandDuration = metricsRegistry.NewHistogram(
+		"tubely_media_command_duration_seconds",
+		"Run time of ffmpeg and ffprobe commands.",
+		[]float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		"command",
+	)
+	mediaCommandFailuresTotal = metricsRegistry.NewCounter(
+		"tubely_media_command_failures_total",
+		"ffmpeg and ffprobe commands that failed.",
+		"command",
+	)
+
+	s3OperationDuration = metricsRegistry.NewHistogram(
+		"tubely_s3_operation_duration_seconds",
+		"Latency of S3 operations.",
+		[]float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+		"operation",
+	)
+	s3OperationErrorsTotal = metricsRegistry.NewCounter(
+		"tubely_s3_operation_errors_total",
+		"S3 operations that failed.",
+		"operation",
+	)
+
+	dbQueryDuration = metricsRegistry.NewHistogram(
+		"tubely_db_query_duration_seconds",
+		"Time taken by database queries outside transactions, by statement type.",
+		[]float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		"operation",
+	)
+	dbQueryErrorsTotal = metricsRegistry.NewCounter(
+		"tubely_db_query_errors_total",
+		"Database queries outside transactions that failed, by statement type.",
+		"operation",
+	)
+)
+
+func observeRequest(method, route string, status int, d time.Duration) {
+	if route == "" {
+		// don't let unmatched paths each make their own series
+		route = "unmatched"
+	}
+	httpRequestsTotal.Inc(method, route, strconv.Itoa(status))
+	httpRequestDuration.Observe(d.Seconds(), method, route)
+}
+
+func observeUpload(kind string, size int64, d time.Duration) {
+	uploadBytesTotal.Add(float64(size), kind)
+	uploadDuration.Observe(d.Seconds(), kind)
+}
+
+func observeDBQuery(operation string, d time.Duration, err error) {
+	dbQueryDuration.Observe(d.Seconds(), operation)
+	if err != nil {
+		dbQueryErrorsTotal.Inc(operation)
+	}
+}
+
+// handlerMetrics serves the metrics for Prometheus to scrape. When
+// METRICS_TOKEN is set, scrapers must send it as a bearer token.
+func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+	if cfg.metricsToken != "" {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.metricsToken)) != 1 {
+			respondWithError(w, http.StatusUnauthorized, "Invalid metrics token", err)
+			return
+		}
+	}
+	metricsRegistry.ServeHTTP(w, r)
+}
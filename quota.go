@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultStorageQuota = 10 << 30 // 10 GB
+	defaultMaxVideos    = 100
+)
+
+// storageQuota limits what each user can store. Zero means unlimited.
+type storageQuota struct {
+	maxBytes  int64
+	maxVideos int
+}
+
+func loadStorageQuota() (storageQuota, error) {
+	maxBytes, err := byteSizeEnv("STORAGE_QUOTA", defaultStorageQuota)
+	if err != nil {
+		return storageQuota{}, err
+	}
+	maxVideos := defaultMaxVideos
+	if value := os.Getenv("MAX_VIDEOS_PER_USER"); value != "" {
+		maxVideos, err = strconv.Atoi(value)
+		if err != nil || maxVideos < 0 {
+			return storageQuota{}, fmt.Errorf("MAX_VIDEOS_PER_USER must be a number of videos, or 0 for unlimited: %q", value)
+		}
+	}
+	return storageQuota{maxBytes: maxBytes, maxVideos: maxVideos}, nil
+}
+
+// remainingBytes is how large an upload replacing a file of replacing bytes
+// may be.
+func (q storageQuota) remainingBytes(usage database.StorageUsage, replacing int64) int64 {
+	if q.maxBytes == 0 {
+		return math.MaxInt64
+	}
+	return q.maxBytes - usage.TotalBytes() + replacing
+}
+
+func (q storageQuota) limits() database.StorageLimits {
+	return database.StorageLimits{MaxBytes: q.maxBytes, MaxVideos: q.maxVideos}
+}
+
+// checkVideoUpload responds and returns false if the video's owner has no
+// room left for its file. The size of the upload is checked with
+// checkStorageQuota once it is known.
+func (cfg *apiConfig) checkVideoUpload(w http.ResponseWriter, usage database.StorageUsage, video database.Video) bool {
+	if video.VideoURL == nil && cfg.storageQuota.maxVideos > 0 && usage.VideoCount >= cfg.storageQuota.maxVideos {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("You have reached your limit of %d videos", cfg.storageQuota.maxVideos), nil)
+		return false
+	}
+	return cfg.checkStorageQuota(w, usage, video.VideoSize, 1)
+}
+
+// checkStorageQuota responds with 413 and returns false if storing size bytes
+// in place of replacing bytes would put the user over their quota. It only
+// rejects uploads early; the quota is enforced when the file is stored.
+func (cfg *apiConfig) checkStorageQuota(w http.ResponseWriter, usage database.StorageUsage, replacing, size int64) bool {
+	if size > cfg.storageQuota.remainingBytes(usage, replacing) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Storage quota exceeded", nil)
+		return false
+	}
+	return true
+}
+
+// respondWithStoreFileError responds to an error from storing an uploaded
+// file, which may be the owner running out of room.
+func (cfg *apiConfig) respondWithStoreFileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrStorageQuotaExceeded):
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Storage quota exceeded", nil)
+	case errors.Is(err, database.ErrVideoLimitReached):
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("You have reached your limit of %d videos", cfg.storageQuota.maxVideos), nil)
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+	}
+}
+
+func (cfg *apiConfig) handlerUsageGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		database.StorageUsage
+		TotalBytes int64 `json:"total_bytes"`
+		// QuotaBytes and MaxVideos are nil when unlimited.
+		QuotaBytes *int64 `json:"quota_bytes"`
+		MaxVideos  *int   `json:"max_videos"`
+	}
+
+	usage, err := cfg.db.GetStorageUsage(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
+		return
+	}
+
+	resp := response{
+		StorageUsage: usage,
+		TotalBytes:   usage.TotalBytes(),
+	}
+	if cfg.storageQuota.maxBytes > 0 {
+		resp.QuotaBytes = &cfg.storageQuota.maxBytes
+	}
+	if cfg.storageQuota.maxVideos > 0 {
+		resp.MaxVideos = &cfg.storageQuota.maxVideos
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// byteSizeEnv parses an optional size variable such as "500MB" or "10GB",
+// or a plain number of bytes, falling back to def when unset. 0 means unlimited.
+func byteSizeEnv(key string, def int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	number, unit := strings.TrimSpace(value), int64(1)
+	for _, suffix := range []struct {
+		name string
+		size int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40}} {
+		if strings.HasSuffix(strings.ToUpper(number), suffix.name) {
+			number, unit = strings.TrimSpace(number[:len(number)-len(suffix.name)]), suffix.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("%s must be a size like 500MB or 10GB: %q", key, value)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestRemainingBytes(t *testing.T) {
+	usage := database.StorageUsage{VideoBytes: 600, ThumbnailBytes: 100}
+	tests := []struct {
+		name      string
+		quota     storageQuota
+		replacing int64
+		want      int64
+	}{
+		{name: "unlimited", quota: storageQuota{}, want: math.MaxInt64},
+		{name: "room left", quota: storageQuota{maxBytes: 1000}, want: 300},
+		{name: "replacing frees its size", quota: storageQuota{maxBytes: 1000}, replacing: 100, want: 400},
+		{name: "full", quota: storageQuota{maxBytes: 700}, want: 0},
+		{name: "over after quota lowered", quota: storageQuota{maxBytes: 500}, want: -200},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.quota.remainingBytes(usage, tc.replacing)
+			if got != tc.want {
+				t.Errorf("remainingBytes() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// runSetRoleCommand handles `tubely set-role <email> <role>`, which is how the
+// first admin is created.
+func runSetRoleCommand(db database.Store, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: set-role <email> <user | moderator | admin>")
+	}
+
+	role, err := database.ParseRole(args[1])
+	if err != nil {
+		return err
+	}
+	user, err := db.GetUserByEmail(normalizeEmail(args[0]))
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return fmt.Errorf("no user with email %q", args[0])
+	}
+
+	err = db.SetUserRole(user.ID, role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s\n", user.Email, role)
+	return nil
+}
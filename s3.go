@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// putS3Object uploads an object, logging how long it took and whether it failed.
+func (cfg *apiConfig) putS3Object(ctx context.Context, params *s3.PutObjectInput) error {
+	start := time.Now()
+	_, err := cfg.s3Client.PutObject(ctx, params)
+	logS3Operation(ctx, "PutObject", aws.ToString(params.Key), start, err)
+	return err
+}
+
+// deleteS3Object deletes an object, logging how long it took and whether it failed.
+func (cfg *apiConfig) deleteS3Object(ctx context.Context, params *s3.DeleteObjectInput) error {
+	start := time.Now()
+	_, err := cfg.s3Client.DeleteObject(ctx, params)
+	logS3Operation(ctx, "DeleteObject", aws.ToString(params.Key), start, err)
+	return err
+}
+
+// logS3Operation logs and records metrics for an operation started at start.
+func logS3Operation(ctx context.Context, operation, key string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	s3OperationDuration.Observe(elapsed.Seconds(), operation)
+	attrs := []any{
+		slog.String("operation", operation),
+		slog.String("key", key),
+		slog.Float64("duration_ms", milliseconds(elapsed)),
+	}
+	if err != nil {
+		s3OperationErrorsTotal.Inc(operation)
+		logger(ctx).Error("S3 operation failed", append(attrs, slog.String("error", err.Error()))...)
+		return
+	}
+	logger(ctx).Info("S3 operation finished", attrs...)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTrashRetention     = 30 * 24 * time.Hour
+	defaultTrashPurgeInterval = time.Hour
+	trashPurgeBatchSize       = 100
+)
+
+type trashedVideo struct {
+	database.Video
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+func (cfg *apiConfig) handlerVideosTrashRetrieve(w http.ResponseWriter, r *http.Request) {
+	userID := requestPrincipal(r).UserID
+
+	videos, err := cfg.db.GetTrashedVideos(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trash", err)
+		return
+	}
+
+	trash := make([]trashedVideo, len(videos))
+	for i, video := range videos {
+		trash[i] = trashedVideo{
+			Video:   video,
+			PurgeAt: video.DeletedAt.Add(cfg.trashRetention),
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, trash)
+}
+
+func (cfg *apiConfig) handlerVideoRestore(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetTrashedVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if !authorizeVideo(w, r, video) {
+		return
+	}
+
+	err = cfg.db.RestoreVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, videoID)
+}
+
+// runTrashPurger permanently deletes expired trash every interval until ctx is done.
+func (cfg *apiConfig) runTrashPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := cfg.purgeExpiredTrash(ctx)
+		if err != nil {
+			slog.Error("Trash purge failed", "error", err)
+		} else if n > 0 {
+			slog.Info("Purged videos from trash", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeExpiredTrash deletes the stored objects and rows of every video that
+// has been in the trash longer than the retention period. A video whose files
+// can't be removed is logged and kept so the next run retries it.
+func (cfg *apiConfig) purgeExpiredTrash(ctx context.Context) (int, error) {
+	cutoff := time.Now().UTC().Add(-cfg.trashRetention)
+	purged := 0
+	skipped := 0
+	for {
+		// kept rows stay at the front of the list, so page past them
+		videos, err := cfg.db.GetExpiredTrash(cutoff, trashPurgeBatchSize, skipped)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, video := range videos {
+			videoCtx := withLogVideo(ctx, video.ID)
+			err = cfg.deleteVideoAssets(videoCtx, video)
+			if err != nil {
+				logger(videoCtx).Error("Couldn't delete assets of trashed video", "error", err)
+				skipped++
+				continue
+			}
+			err = cfg.db.DeleteVideo(video.ID)
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(videos) < trashPurgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// deleteVideoAssets removes the video's S3 object and local thumbnail file, if any.
+func (cfg *apiConfig) deleteVideoAssets(ctx context.Context, video database.Video) error {
+	if video.VideoURL != nil {
+		err := cfg.deleteVideoFile(ctx, *video.VideoURL)
+		if err != nil {
+			return err
+		}
+	}
+	if video.ThumbnailURL != nil {
+		err := cfg.deleteThumbnailFile(*video.ThumbnailURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteVideoFile removes the S3 object at videoURL, ignoring URLs outside
+// the distribution.
+func (cfg *apiConfig) deleteVideoFile(ctx context.Context, videoURL string) error {
+	fileKey, ok := strings.CutPrefix(videoURL, cfg.s3CfDistribution+"/")
+	if !ok {
+		return nil
+	}
+	return cfg.deleteS3Object(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(fileKey),
+	})
+}
+
+// deleteThumbnailFile removes the local file at thumbnailURL, ignoring URLs
+// of other servers.
+func (cfg *apiConfig) deleteThumbnailFile(thumbnailURL string) error {
+	assetsURL := fmt.Sprintf("http://localhost:%s/assets/", cfg.port)
+	fileName, ok := strings.CutPrefix(thumbnailURL, assetsURL)
+	if !ok {
+		return nil
+	}
+	err := os.Remove(filepath.Join(cfg.assetsRoot, filepath.Base(fileName)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
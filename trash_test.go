@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestPurgeExpiredTrashSkipsFailedVideos(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.port = "8091"
+	cfg.assetsRoot = t.TempDir()
+	cfg.trashRetention = -time.Hour
+
+	// removing a non-empty directory fails, so thumbnails pointing at it can't be deleted
+	err := os.MkdirAll(filepath.Join(cfg.assetsRoot, "stuck", "file"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashedPassword, err := auth.HashPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := cfg.db.CreateUser(database.CreateUserParams{Email: "user@example.com", Password: hashedPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trashVideo := func(thumbnailURL string) uuid.UUID {
+		t.Helper()
+		video, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "video", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if thumbnailURL != "" {
+			_, err = cfg.db.SetThumbnailFile(video.ID, thumbnailURL, 1, database.StorageLimits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = cfg.db.TrashVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return video.ID
+	}
+
+	// a full batch of failing videos, trashed first, must not hide the rest
+	stuckURL := "http://localhost:8091/assets/stuck"
+	failed := []uuid.UUID{}
+	for range trashPurgeBatchSize {
+		failed = append(failed, trashVideo(stuckURL))
+	}
+	purgeable := trashVideo("")
+
+	n, err := cfg.purgeExpiredTrash(context.Background())
+	if err != nil {
+		t.Fatalf("purgeExpiredTrash() error = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("purgeExpiredTrash() = %d, want 1", n)
+	}
+
+	video, err := cfg.db.GetTrashedVideo(purgeable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.ID != uuid.Nil {
+		t.Error("purgeable video is still in the trash")
+	}
+	for _, id := range failed {
+		video, err = cfg.db.GetTrashedVideo(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if video.ID != id {
+			t.Fatalf("video %s was purged although its thumbnail wasn't deleted", id)
+		}
+	}
+}
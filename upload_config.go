@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// videoUploadExtensions and thumbnailUploadExtensions are the media types
+// uploads may be allowed for, and the extension stored files get. Videos are
+// all remuxed to mp4 by processVideoForFastStart.
+var (
+	videoUploadExtensions = map[string]string{
+		"video/mp4":       ".mp4",
+		"video/quicktime": ".mp4",
+	}
+	thumbnailUploadExtensions = map[string]string{
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+	}
+)
+
+// uploadLimits are what a user may upload.
+type uploadLimits struct {
+	maxVideoSize     int64
+	maxThumbnailSize int64
+	// videoTypes and thumbnailTypes map allowed media types to extensions.
+	videoTypes     map[string]string
+	thumbnailTypes map[string]string
+}
+
+// uploadConfig holds the default upload limits and any per-role overrides.
+type uploadConfig struct {
+	defaults uploadLimits
+	byRole   map[database.Role]uploadLimits
+}
+
+func (c uploadConfig) forRole(role database.Role) uploadLimits {
+	if limits, ok := c.byRole[role]; ok {
+		return limits
+	}
+	return c.defaults
+}
+
+// loadUploadConfig reads MAX_VIDEO_UPLOAD_SIZE, MAX_THUMBNAIL_UPLOAD_SIZE,
+// VIDEO_UPLOAD_TYPES and THUMBNAIL_UPLOAD_TYPES. Each can be overridden for a
+// role by suffixing it with the role, e.g. MAX_VIDEO_UPLOAD_SIZE_ADMIN.
+func loadUploadConfig() (uploadConfig, error) {
+	defaults, err := loadUploadLimits("", uploadLimits{
+		maxVideoSize:     1 << 30, // 1 GB
+		maxThumbnailSize: 10 << 20,
+		videoTypes:       pickExtensions(videoUploadExtensions, "video/mp4"),
+		thumbnailTypes:   pickExtensions(thumbnailUploadExtensions, "image/jpeg", "image/png"),
+	})
+	if err != nil {
+		return uploadConfig{}, err
+	}
+
+	config := uploadConfig{
+		defaults: defaults,
+		byRole:   map[database.Role]uploadLimits{},
+	}
+	for _, role := range []database.Role{database.RoleUser, database.RoleModerator, database.RoleAdmin} {
+		limits, err := loadUploadLimits("_"+strings.ToUpper(string(role)), defaults)
+		if err != nil {
+			return uploadConfig{}, err
+		}
+		config.byRole[role] = limits
+	}
+	return config, nil
+}
+
+// loadUploadLimits reads the upload variables with the given suffix, keeping
+// the values in def for those that are unset.
+func loadUploadLimits(suffix string, def uploadLimits) (uploadLimits, error) {
+	limits := def
+	var err error
+	limits.maxVideoSize, err = byteSizeEnv("MAX_VIDEO_UPLOAD_SIZE"+suffix, def.maxVideoSize)
+	if err != nil {
+		return uploadLimits{}, err
+	}
+	limits.maxThumbnailSize, err = byteSizeEnv("MAX_THUMBNAIL_UPLOAD_SIZE"+suffix, def.maxThumbnailSize)
+	if err != nil {
+		return uploadLimits{}, err
+	}
+	limits.videoTypes, err = mediaTypesEnv("VIDEO_UPLOAD_TYPES"+suffix, videoUploadExtensions, def.videoTypes)
+	if err != nil {
+		return uploadLimits{}, err
+	}
+	limits.thumbnailTypes, err = mediaTypesEnv("THUMBNAIL_UPLOAD_TYPES"+suffix, thumbnailUploadExtensions, def.thumbnailTypes)
+	if err != nil {
+		return uploadLimits{}, err
+	}
+	if limits.maxVideoSize == 0 || limits.maxThumbnailSize == 0 {
+		return uploadLimits{}, fmt.Errorf("upload sizes%s can't be unlimited", suffix)
+	}
+	return limits, nil
+}
+
+// mediaTypesEnv parses an optional comma-separated list of media types, each
+// of which must be in supported, falling back to def when unset.
+func mediaTypesEnv(key string, supported, def map[string]string) (map[string]string, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	types := map[string]string{}
+	for _, mediaType := range strings.Split(value, ",") {
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		ext, ok := supported[mediaType]
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported media type %q, expected some of %s", key, mediaType, strings.Join(sortedKeys(supported), ", "))
+		}
+		types[mediaType] = ext
+	}
+	return types, nil
+}
+
+func pickExtensions(supported map[string]string, mediaTypes ...string) map[string]string {
+	picked := map[string]string{}
+	for _, mediaType := range mediaTypes {
+		picked[mediaType] = supported[mediaType]
+	}
+	return picked
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}